@@ -0,0 +1,196 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var adminLog = logging.Module("admin")
+
+// SetAdmins replaces the list of nicks allowed to run admin commands.
+func (bot *IrcBot) SetAdmins(nicks []string) {
+	bot.admins = make(map[string]bool)
+	for _, nick := range nicks {
+		bot.admins[strings.ToLower(nick)] = true
+	}
+}
+
+// IsAdmin reports whether nick may run admin commands.
+// TODO: nicks are easy to spoof. Check the user and host too, or whether the nick is identified with services.
+func (bot *IrcBot) IsAdmin(nick string) bool {
+	return bot.admins[strings.ToLower(nick)]
+}
+
+// module returns the registered module with the given name.
+func (bot *IrcBot) module(name string) (Module, bool) {
+	for _, m := range bot.modules {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Module{}, false
+}
+
+// adminCommandRe matches e.g. "gobot, disable combat" or "gobot, set combat-hp 20". The bot's nick is checked
+// separately.
+var adminCommandRe = regexp.MustCompile(`^(\S+)[,:] (enable|disable|set|unset|settings|reload|loglevel|block|unblock|rename|merge|recap|export)\b\s*(.*)$`)
+
+// adminListener handles commands which change how the bot behaves in the channel they're said in.
+func (bot *IrcBot) adminListener() (admin Listener) {
+	admin = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+		if msg.Command != irc.Privmsg {
+			return
+		}
+
+		n := bot.Network(msg.Network)
+		match := adminCommandRe.FindStringSubmatch(msg.Text)
+		if len(match) == 0 || !strings.EqualFold(match[1], n.Nick()) {
+			return
+		}
+
+		if !bot.IsAdmin(msg.Nick) {
+			adminLog.Info("Ignoring command from non-admin", "command", match[2], "nick", msg.Nick)
+			n.Say(ctx, msg.Channel, fmt.Sprintf("Sorry %v, only admins can do that.", msg.Nick))
+			return true, true
+		}
+
+		args := strings.Fields(match[3])
+		n.Say(ctx, msg.Channel, bot.runAdminCommand(ctx, msg, match[2], args))
+		return true, true
+	}
+	return
+}
+
+// runAdminCommand carries out an admin command and returns what to say about it.
+func (bot *IrcBot) runAdminCommand(ctx context.Context, msg irc.Message, cmd string, args []string) string {
+	switch cmd {
+	case "enable", "disable":
+		if len(args) != 1 {
+			return fmt.Sprintf("Usage: %v <module>", cmd)
+		}
+		m, ok := bot.module(args[0])
+		if !ok {
+			return fmt.Sprintf("I don't have a module called %v.", args[0])
+		}
+		if m.Required {
+			return fmt.Sprintf("I can't work without %v.", m.Name)
+		}
+		bot.settings.SetEnabled(msg.Network, msg.Channel, m.Name, cmd == "enable")
+		if cmd == "enable" && bot.resetBreaker(m.Name) {
+			return fmt.Sprintf("OK, %v is back on everywhere, after it was switched off for panicking.", m.Name)
+		}
+		return fmt.Sprintf("OK, %v is %vd in %v.", m.Name, cmd, msg.Channel)
+
+	case "set":
+		if len(args) != 2 {
+			return "Usage: set <setting> <value>"
+		}
+		if err := bot.settings.Set(msg.Network, msg.Channel, args[0], args[1]); err != nil {
+			return fmt.Sprintf("Can't do that: %v.", err)
+		}
+		return fmt.Sprintf("OK, %v is now %v in %v.", args[0], args[1], msg.Channel)
+
+	case "unset":
+		if len(args) != 1 {
+			return "Usage: unset <setting>"
+		}
+		if _, ok := settingDefs[args[0]]; !ok {
+			return fmt.Sprintf("There's no setting called %v.", args[0])
+		}
+		bot.settings.Unset(msg.Network, msg.Channel, args[0])
+		return fmt.Sprintf("OK, %v is back to %v in %v.", args[0], settingDefs[args[0]].def, msg.Channel)
+
+	case "settings":
+		return fmt.Sprintf("Settings for %v: %v.", msg.Channel, bot.settings.Describe(msg.Network, msg.Channel))
+
+	case "loglevel":
+		switch {
+		case len(args) == 0:
+			return fmt.Sprintf("Log levels: %v.", logging.Describe())
+		case len(args) == 2 && args[1] == "reset":
+			logging.ResetLevel(args[0])
+			return fmt.Sprintf("OK, %v is back to logging at %v.", args[0], logging.Level(args[0]))
+		case len(args) == 2:
+			var l slog.Level
+			if err := l.UnmarshalText([]byte(args[1])); err != nil {
+				return fmt.Sprintf("%v isn't debug, info, warn or error.", args[1])
+			}
+			logging.SetLevel(args[0], l)
+			return fmt.Sprintf("OK, %v now logs at %v.", args[0], l)
+		}
+		return "Usage: loglevel [<subsystem or module> <level or reset>]"
+
+	case "block", "unblock":
+		// Things can have spaces in, as in "gobot, block the build".
+		if len(args) == 0 {
+			return fmt.Sprintf("Usage: %v <nick or thing>", cmd)
+		}
+		return blockScore(strings.Join(args, " "), cmd == "block")
+
+	case "rename", "merge":
+		// Names with spaces in need parentheses, as in "gobot, merge (the build) build".
+		names := splitTargets(strings.Join(args, " "))
+		if len(names) != 2 {
+			return fmt.Sprintf("Usage: %v <from> <to>, with (parentheses) around names with spaces in", cmd)
+		}
+		if cmd == "rename" {
+			return renameScore(names[0], names[1])
+		}
+		return mergeScores(names[0], names[1])
+
+	case "recap":
+		isRecap := func(job Job) bool {
+			return job.Kind == "karma-recap" && job.Network == msg.Network && strings.EqualFold(job.Target, msg.Channel)
+		}
+		switch {
+		case len(args) == 0:
+			return strings.Join(recapLines(lastMonth(bot.localNow())), " ")
+		case len(args) == 1 && args[0] == "on":
+			if len(bot.Jobs(isRecap)) > 0 {
+				return fmt.Sprintf("%v already gets a recap every month.", msg.Channel)
+			}
+			job := Job{Kind: "karma-recap", Network: msg.Network, Target: msg.Channel, Every: recapSchedule}
+			if _, err := bot.Schedule(job); err != nil {
+				return fmt.Sprintf("Couldn't schedule it: %v.", err)
+			}
+			return fmt.Sprintf("OK, I'll sum up each month's karma in %v on the first.", msg.Channel)
+		case len(args) == 1 && args[0] == "off":
+			for _, job := range bot.Jobs(isRecap) {
+				bot.Cancel(job.ID)
+			}
+			return fmt.Sprintf("OK, no more recaps in %v.", msg.Channel)
+		}
+		return "Usage: recap [on|off]"
+
+	case "export":
+		// History is everything anyone has said to get a point, so it goes to the admin alone.
+		h := bot.Export()
+		out := fmt.Sprintf("Exported %v points and %v seen records", len(h.Points), len(h.Seen))
+		path, err := bot.exportToStateDir(h)
+		if err != nil {
+			adminLog.Warn("Export failed", "nick", msg.Nick, "err", err)
+			out += fmt.Sprintf(", but couldn't save them: %v", err)
+		} else {
+			out += " to " + path
+		}
+		if bot.statusAddr != "" {
+			out += fmt.Sprintf(". They're also at http://%v/export, or /export?format=csv&table=seen", bot.statusAddr)
+		}
+		bot.Network(msg.Network).Say(ctx, msg.Nick, out+".")
+		return fmt.Sprintf("OK %v, I've sent you the details.", msg.Nick)
+
+	case "reload":
+		if err := bot.reload(); err != nil {
+			adminLog.Warn("Reload failed", "nick", msg.Nick, "err", err)
+			return fmt.Sprintf("Couldn't reload, so I'm sticking with what I had: %v", err)
+		}
+		return "Reloaded."
+	}
+	return ""
+}
@@ -1,23 +1,20 @@
 package youandmeandirc
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math/rand"
-	// "regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+	"github.com/wonderzombie/youandmeandirc/metrics"
 )
 
-type ResultCode int
-
-const (
-	Pass ResultCode = 1 + iota
-	Fired
-	Trap
-)
+var botLog = logging.Subsystem("bot")
 
 // ConnectFn is used to generate connections.
 type ConnectFn func() (*irc.Conn, error)
@@ -25,214 +22,236 @@ type ConnectFn func() (*irc.Conn, error)
 // Listeners are called when a message arrives. The first return value
 // indicates whether the message caused the listener to fire. The second return
 // value indicates whether this listener requires no other listeners to fire.
-type Listener func(irc.Message) (bool, bool)
-
-// TODO: replace Listener with BotListener. This will allow just to just enumerate Listeners
-// instead of the rigmarole right now, where methods on IrcBot return Listeners.
-type BotListener func(*IrcBot, irc.Message) (bool, bool)
-
-type IrcBot struct {
-	irc       *irc.Conn
-	listeners []Listener
-	connectFn ConnectFn
-
-	channels []string
-
-	namesSet map[string]bool
+//
+// ctx has a deadline, after which anything the listener says is dropped. Listeners
+// doing anything slow should give up when it's done.
+type Listener func(ctx context.Context, msg irc.Message) (bool, bool)
 
-	uptime time.Time
+// Scope says whether a module's state is shared by every network or kept separately for each one.
+type Scope int
 
-	seenList map[string]SeenInfo
-
-	asleep bool
-
-	healthList map[string]int
-
-	rng *rand.Rand
+const (
+	// Shared modules are built once and see messages from every network, e.g. karma.
+	Shared Scope = iota
+	// PerNetwork modules are built once for each network, so whatever state their listener closes over is kept
+	// separately per network, e.g. seen.
+	PerNetwork
+)
 
-	triggers map[TriggerId]Trigger
+// Module is a named, scoped source of Listeners.
+type Module struct {
+	Name  string
+	Scope Scope
+	// New builds the module's Listener. n is the network it will listen to, or nil for Shared modules. m is the
+	// module's handle for its own metrics; see ModuleMetrics.
+	New func(n *Network, m ModuleMetrics) Listener
+	// Required modules can't be disabled in a channel.
+	Required bool
+	// Async modules' listeners run on their own goroutines, so they can take their time without holding up other
+	// modules. They can't trap messages, and they have to do their own locking.
+	//
+	// Off the dispatch loop, it's safe to call Reply, Network and Lag on the bot, anything on a Network other than
+	// its modules' state, and Settings. Everything else the bot and its modules keep, such as scores and seen, belongs
+	// to the dispatch loop and mustn't be touched; in this package, bot.do runs a function there.
+	Async bool
 }
 
-type TriggerId string
-
-// API is like this, roughly:
-// Your module implements some function that returns some item that satisfies this interface.
-// Id() is used to identify your module to other modules. Therefore anything you export
-// on your struct is the API for other modules to interact with yours.
-type Trigger interface {
-	Id() TriggerId
-	Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode
+// moduleListener is a module's Listener on a particular network.
+type moduleListener struct {
+	Module
+	fire Listener
 }
 
-func (bot *IrcBot) init() error {
-	bot.listeners = []Listener{
-		bot.sleepListener(), // This must come first.
-		bot.joinListener(),
-		bot.namesListener(),
-		bot.regexListener(),
-		bot.scoreListener(),
-		bot.seenListener(),
-		bot.combatListener(),
-		bot.uptimeListener(),
-		bot.onNameListener(), // This should go last.
+// shared is shorthand for a Shared module.
+func shared(name string, fn func() Listener) Module {
+	return Module{
+		Name:  name,
+		Scope: Shared,
+		New:   func(*Network, ModuleMetrics) Listener { return fn() },
 	}
-	bot.namesSet = make(map[string]bool)
-	bot.healthList = make(map[string]int)
-	return nil
 }
 
-// registerDefaults is a temporary method until I replace the old API.
-func (bot *IrcBot) registerDefaults() {
-	bot.RegisterAll(
-		// This one should come first, if it's to abort all the rest.
-		SleepTrigger{},
-		JoinPartTrigger{},
-		RegexTrigger{},
-		CombatTrigger{},
-		ScoreTrigger{},
-		SeenTrigger{},
-	)
+// perNetwork is shorthand for a PerNetwork module.
+func perNetwork(name string, fn func(*Network) Listener) Module {
+	return Module{
+		Name:  name,
+		Scope: PerNetwork,
+		New:   func(n *Network, _ ModuleMetrics) Listener { return fn(n) },
+	}
 }
 
-func (bot *IrcBot) Register(t Trigger) {
-	id := t.Id()
-	bot.triggers[id] = t
+// required marks m as a module which can't be disabled.
+func required(m Module) Module {
+	m.Required = true
+	return m
 }
 
-func (bot *IrcBot) RegisterAll(ts ...Trigger) {
-	for _, t := range ts {
-		bot.Register(t)
-	}
+// async marks m as a module whose listener runs on its own goroutine.
+func async(m Module) Module {
+	m.Async = true
+	return m
 }
 
-func (bot *IrcBot) Trigger(id TriggerId) Trigger {
-	t, ok := bot.triggers[id]
-	if !ok {
-		return nil
-	}
-	return t
-}
+type IrcBot struct {
+	networks map[string]*Network
+	inbox    chan irc.Message
+	// control runs functions on the dispatch loop, for goroutines which need to touch the bot's state.
+	control chan func()
+	started bool
+	// stopped is closed once the dispatch loop has stopped for good.
+	stopped chan struct{}
+
+	configPath string
+	// quitMessage is sent to every network on the way out. drainTimeout bounds how long we wait for queued lines to
+	// go out first.
+	quitMessage  string
+	drainTimeout time.Duration
+
+	stateDir  string
+	persisted []persisted
+
+	// statusAddr is where StatusHandler is served, if anywhere.
+	statusAddr  string
+	statusToken string
+
+	modules []Module
+	// triggers are the old way modules find each other, by Id. See Trigger.
+	triggers map[TriggerId]Trigger
+	// shared holds the single Listener for each Shared module, by name.
+	shared map[string]Listener
 
-func (bot *IrcBot) Random(max int) int {
-	return bot.rng.Int() % max
-}
+	// breakers track which modules have been panicking, by name. alertNick is told when they do.
+	breakers  map[string]*breaker
+	alertNick string
 
-type PingTrigger struct{}
+	// handlerCtx is the parent of every handler's context. handlerTimeout is how long each handler gets. async
+	// tracks async handlers which are still running, and asyncSlots bounds how many each module can have at once.
+	handlerCtx     context.Context
+	handlerTimeout time.Duration
+	async          sync.WaitGroup
+	asyncSlots     map[string]chan struct{}
 
-func (p *PingTrigger) Id() TriggerId {
-	return TriggerId("ping")
-}
+	// schedule is what the bot has to do later, and jobFuncs how to do it.
+	schedule schedule
+	jobFuncs map[jobKey]JobFunc
 
-func (p *PingTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) bool {
-	if len(ids) > 0 {
-		log.Println("Warning: other triggers called before: ", ids)
-	}
+	// registry holds the bot's metrics, and modules'.
+	registry *metrics.Registry
+	metrics  botMetrics
 
-	if msg.Command == irc.Ping {
-		bot.irc.Pong(msg.Source)
-		return false
-	}
+	settings *Settings
+	admins   map[string]bool
 
-	return true
-}
+	clock Clock
+	// location is the timezone times are shown in, unless someone has picked their own in timezones, by timezoneKey.
+	location  *time.Location
+	timezones timezones
 
-func (bot *IrcBot) pingListener() (pong Listener) {
-	pong = func(msg irc.Message) (fired, trap bool) {
-		if msg.Command == irc.Ping {
-			bot.irc.Pong(msg.Source)
-			fired, trap = true, true
-		}
-		return
-	}
-	return
+	rng *rand.Rand
 }
 
-type JoinPartTrigger struct {
-	NamesSet map[string]bool
-}
+func (bot *IrcBot) init() error {
+	bot.networks = make(map[string]*Network)
+	bot.inbox = make(chan irc.Message)
+	bot.control = make(chan func())
+	bot.clock = realClock{}
+	bot.location = time.UTC
+	bot.timezones = make(timezones)
+	bot.stopped = make(chan struct{})
+	bot.quitMessage = defaultQuitMessage
+	bot.drainTimeout = defaultDrainTimeout
 
-func (t JoinPartTrigger) Id() TriggerId {
-	return TriggerId("namelist")
+	// Initialize RNG.
+	src := rand.NewSource(time.Now().UnixNano())
+	bot.rng = rand.New(src)
+	bot.shared = make(map[string]Listener)
+	bot.breakers = make(map[string]*breaker)
+	bot.handlerCtx = context.Background()
+	bot.handlerTimeout = defaultHandlerTimeout
+	bot.asyncSlots = make(map[string]chan struct{})
+	bot.jobFuncs = make(map[jobKey]JobFunc)
+	bot.persist("schedule", &bot.schedule)
+	bot.HandleJobs("", "say", bot.sayJob)
+	bot.initMetrics()
+	bot.settings = NewSettings()
+	bot.admins = make(map[string]bool)
+
+	bot.RegisterAll(
+		// This comes before sleep, so that the bot keeps track of who's around and talking while it's asleep.
+		required(perNetwork("members", bot.membersListener)),
+		perNetwork("sleep", bot.sleepListener), // This must come before anything that talks.
+		// This comes before anything else that might trap, so memos go out whatever their recipient says first.
+		perNetwork("tell", bot.tellListener),
+		required(shared("admin", bot.adminListener)),
+		shared("regex", bot.regexListener),
+		Module{Name: "score", Scope: Shared, New: bot.scoreListener},
+		perNetwork("seen", bot.seenListener),
+		Module{Name: "combat", Scope: PerNetwork, New: bot.combatListener},
+		shared("uptime", bot.uptimeListener),
+		shared("remind", bot.remindListener),
+		shared("timezone", bot.timezoneListener),
+		shared("replies", bot.onNameListener), // This should go last.
+	)
+	bot.triggers = make(map[TriggerId]Trigger)
+	bot.registerDefaults()
+	return nil
 }
 
-func (t JoinPartTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
-	if msg.Command != irc.Join && msg.Command != irc.Part {
-		return Pass
+// Register adds a module. Its listener runs after those of every module registered before it.
+func (bot *IrcBot) Register(m Module) {
+	bot.modules = append(bot.modules, m)
+	if m.Async {
+		bot.asyncSlots[m.Name] = make(chan struct{}, maxAsyncHandlers)
 	}
-
-	if msg.Nick == bot.irc.Nick() {
-		return Pass
+	if m.Scope == Shared {
+		bot.shared[m.Name] = m.New(nil, bot.Metrics(m.Name))
 	}
-
-	_, ok := t.NamesSet[msg.Source]
-	if ok && msg.Command == irc.Part || msg.Command == irc.Quit {
-		log.Println("Received part or quit, so removing name:", msg.Nick)
-		t.NamesSet[msg.Nick] = false
+	for _, n := range bot.networks {
+		n.listeners = append(n.listeners, bot.listenerFor(m, n))
 	}
+}
 
-	if !ok {
-		log.Println("Adding nick to list of names:", msg.Nick)
-		t.NamesSet[msg.Nick] = true
+func (bot *IrcBot) RegisterAll(ms ...Module) {
+	for _, m := range ms {
+		bot.Register(m)
 	}
-
-	return Fired
 }
 
-func (bot *IrcBot) joinListener() (join Listener) {
-	join = func(msg irc.Message) (fired, trap bool) {
-		if msg.Command != irc.Join {
-			return
-		}
-
-		_, ok := bot.namesSet[msg.Nick]
-		if !ok && msg.Nick != bot.irc.Nick() {
-			log.Println("Adding nick to list of names:", msg.Nick)
-			// bot.names = append(bot.names, msg.Nick)
-			bot.namesSet[msg.Nick] = true
-		}
-
-		// This fired, but don't trap it.
-		return true, false
+func (bot *IrcBot) listenerFor(m Module, n *Network) moduleListener {
+	if m.Scope == Shared {
+		return moduleListener{m, bot.shared[m.Name]}
 	}
-	return
+	return moduleListener{m, m.New(n, bot.Metrics(m.Name))}
 }
 
-type MentionMeTrigger struct{}
-
-func (t *MentionMeTrigger) Id() TriggerId {
-	return TriggerId("mentionme")
+// AddNetwork adds a network for the bot to connect to once it starts. dial is called to connect, and again to
+// reconnect whenever the connection drops.
+func (bot *IrcBot) AddNetwork(name string, channels []string, dial ConnectFn) *Network {
+	n := newNetwork(name, channels, dial)
+	n.setClock(bot.clock)
+	for _, m := range bot.modules {
+		n.listeners = append(n.listeners, bot.listenerFor(m, n))
+	}
+	bot.networks[name] = n
+	return n
 }
 
-func (t *MentionMeTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) bool {
-	if msg.Command != irc.Privmsg || msg.Source == bot.irc.Nick() {
-		return false
+// Lag is the current lag to the named network's server. See Network.Lag.
+func (bot *IrcBot) Lag(network string) time.Duration {
+	n := bot.Network(network)
+	if n == nil {
+		return 0
 	}
+	return n.Lag()
+}
 
-	sayings := []string{
-		"I'd love to help, but I need to finish my post on LJ.",
-		"Hold that thought, BRB",
-		"That's an astute observation.  I would have never thought that!",
-		"Sorry, lag.",
-		"You know, I try and try, and I'm just never good enough.  Do you ever feel that way?",
-		"Can you show me?  Give me a PM.",
-		"Are you saying you'll go out with me?",
-		"I made some icons of that once and used them in my LJ.",
-		"I disagree, but I respect your opinion.",
-		"I didn't know you felt that way about me.",
-		"Sorry, still catching up with scrollback.",
-		"I was thinking the same thing.",
-		"I kissed a boy today.",
-	}
-
-	mentioned := sortaContains(msg.Text, bot.irc.Nick())
-	if !mentioned {
-		return false
-
-	}
+// Network returns the named network, or nil if there isn't one.
+func (bot *IrcBot) Network(name string) *Network {
+	return bot.networks[name]
+}
 
-	choice := bot.Random(len(sayings))
-	bot.Say(msg.Channel, sayings[choice])
-	return true
+func (bot *IrcBot) Random(max int) int {
+	return bot.rng.Int() % max
 }
 
 func (bot *IrcBot) onNameListener() (name Listener) {
@@ -252,94 +271,72 @@ func (bot *IrcBot) onNameListener() (name Listener) {
 		"I kissed a boy today.",
 	}
 
-	name = func(msg irc.Message) (fired, trap bool) {
-		if msg.Command != irc.Privmsg || !strings.Contains(msg.Text, bot.irc.Nick()) {
+	name = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+		if msg.Command != irc.Privmsg || !strings.Contains(msg.Text, bot.Network(msg.Network).Nick()) {
 			return
 		}
 
-		choice := bot.Random(len(sayings))
-		bot.Say(msg.Channel, sayings[choice])
+		saying := sayings[bot.Random(len(sayings))]
+		if lag := bot.Lag(msg.Network); saying == "Sorry, lag." && lag > 0 {
+			saying = fmt.Sprintf("Sorry, lag. It's %v right now.", lag.Round(time.Millisecond))
+		}
+		bot.Reply(ctx, msg, saying)
 		return true, true
 	}
 	return
 }
 
-func (bot *IrcBot) runTriggers(msg irc.Message) {
-	var triggered []TriggerId
-	for id, t := range bot.triggers {
-		res := t.Fire(msg, bot, triggered)
-		switch res {
-		case Fired:
-			triggered = append(triggered, id)
-		case Trap:
-			return
-		}
+func (bot *IrcBot) runListeners(msg irc.Message) {
+	n := bot.Network(msg.Network)
+	if n == nil {
+		botLog.Warn("Dropping message from unknown network", "network", msg.Network)
+		return
 	}
-}
 
-func (bot *IrcBot) runListeners(msg irc.Message) {
-	for _, l := range bot.listeners {
+	bot.metrics.received.Inc(msg.Network, commandName(msg))
+	for _, l := range n.listeners {
+		if !l.Required && msg.Channel != "" && !bot.settings.Enabled(msg.Network, msg.Channel, l.Name) {
+			continue
+		}
+		if bot.tripped(l.Name) {
+			continue
+		}
+		if l.Async {
+			bot.handleAsync(l, msg)
+			continue
+		}
 		// TODO: simplify this. We probably only need one and that'd be trap.
-		if _, trap := l(msg); trap {
+		if trap := bot.handle(l, msg); trap {
 			return
 		}
 	}
 }
 
-func (bot *IrcBot) askForNames() {
-	for _, channel := range bot.channels {
-		bot.irc.Names(channel)
-	}
-}
-
 func (bot *IrcBot) uptimeListener() (uptime Listener) {
-	uptime = func(msg irc.Message) (fired, trap bool) {
+	uptime = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
 		if msg.Command != irc.Privmsg {
 			return
 		}
 
+		n := bot.Network(msg.Network)
 		lower := strings.ToLower(msg.Text)
-		expected := fmt.Sprintf("%v, uptime?", bot.irc.Nick)
+		expected := fmt.Sprintf("%v, uptime?", strings.ToLower(n.Nick()))
 		if lower != expected {
 			return
 		}
 
-		bot.irc.Say(msg.Channel, fmt.Sprintf("Uptime is %v", time.Since(bot.uptime)))
+		n.Say(ctx, msg.Channel, fmt.Sprintf("Uptime is %v", n.Uptime()))
 		return true, true
 	}
 	return
 }
 
-func (bot *IrcBot) namesListener() (names Listener) {
-	// This can actually be multiple lines. The termination line that you want is 366.
-	code := "353"
-
-	names = func(msg irc.Message) (fired, trap bool) {
-		if code != msg.Code {
-			return
-		}
-
-		names := strings.Fields(msg.Text)
-		ops := "@+"
-		for _, name := range names {
-			name = strings.Trim(name, ops)
-			bot.namesSet[name] = true
-		}
-		bot.namesSet[bot.irc.Nick()] = true
-
-		log.Println("Names are now:", bot.namesSet)
-
-		return true, false
-	}
-	return
-}
-
-// Wrapper around IrcConn.Say which simulates typing.
-func (bot *IrcBot) Say(channel, out string) {
-	ms := 10 * len(out)
+// Reply is a wrapper around Network.Say which simulates typing. The reply goes to the channel msg came from.
+func (bot *IrcBot) Reply(ctx context.Context, msg irc.Message, out string) {
+	perChar := bot.settings.Duration(msg.Network, msg.Channel, "typing-delay")
 	// Pretend we're typing.
-	time.Sleep(time.Duration(ms) * time.Millisecond)
-	bot.irc.Say(channel, out)
+	bot.clock.Sleep(time.Duration(len(out)) * perChar)
+	bot.Network(msg.Network).Say(ctx, msg.Channel, out)
 }
 
 // Creates a new bot.
@@ -352,32 +349,104 @@ func NewBot() (*IrcBot, error) {
 	return bot, nil
 }
 
-// Starts a bot running.
-func (bot *IrcBot) Start(c *irc.Conn) {
-	bot.irc = c
-	joined := false
-
-	// Initialize RNG.
-	src := rand.NewSource(time.Now().UnixNano())
-	bot.rng = rand.New(src)
+// Starts a bot running: connects to every network and handles their messages as they arrive, until ctx is done.
+// Then it shuts down: see shutdown. The error says what, if anything, went wrong on the way out.
+func (bot *IrcBot) Start(ctx context.Context) error {
+	bot.started = true
+	var wg sync.WaitGroup
+	if bot.statusAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bot.serveStatus(ctx, bot.statusAddr, bot.statusToken)
+		}()
+	}
+	for _, n := range bot.networks {
+		wg.Add(1)
+		go func(n *Network) {
+			defer wg.Done()
+			n.run(ctx, bot.inbox)
+		}(n)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bot.runScheduler(ctx)
+	}()
+	if bot.stateDir != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bot.runFlusher(ctx)
+		}()
+	}
 
-	for {
-		m, err := bot.irc.Read()
-		// fmt.Printf("%+v\n", *m)
-		if err != nil {
-			log.Fatalf("Unable to parse message from server: %v", err)
+	// Handlers get contexts which are cancelled once we stop.
+	handlerCtx, cancelHandlers := context.WithCancel(ctx)
+	bot.handlerCtx = handlerCtx
+
+	// Every listener runs here, one message at a time, so module state needs no locking. Async modules are the
+	// exception.
+	for ctx.Err() == nil {
+		select {
+		case m := <-bot.inbox:
+			bot.runListeners(m)
+		case fn := <-bot.control:
+			fn()
+		case <-ctx.Done():
 		}
+	}
+	close(bot.stopped)
+	cancelHandlers()
+	bot.async.Wait()
+
+	err := bot.shutdown()
+	wg.Wait()
+	return err
+}
 
-		// TODO: uh, look at the actual codes so we know when we've joined. This is a bit hacky.
-		if !joined && m.Nick == bot.irc.Nick() && m.Command == irc.Mode {
-			bot.irc.Join("#testbot")
-			// Sorta dumb, but basically don't count uptime until we've joined a channel.
-			bot.uptime = time.Now()
-			joined = true
-			// Collect a list of names.
-			bot.askForNames()
-		} else {
-			bot.runListeners(*m)
+// do runs fn on the dispatch loop and waits for it to finish, so that fn can touch module state. It returns an error,
+// without running fn, if the bot has stopped.
+func (bot *IrcBot) do(fn func()) error {
+	done := make(chan struct{})
+	select {
+	case bot.control <- func() { fn(); close(done) }:
+	case <-bot.stopped:
+		return fmt.Errorf("the bot has stopped")
+	}
+	<-done
+	return nil
+}
+
+// shutdown stops the bot once it's stopped handling messages. Each network gets until drainTimeout to send what's
+// already queued, then gets a QUIT, and its transcript is closed. Finally, module state is flushed.
+func (bot *IrcBot) shutdown() error {
+	botLog.Info("Shutting down")
+	var errs []error
+
+	drained, cancel := context.WithTimeout(context.Background(), bot.drainTimeout)
+	defer cancel()
+	for _, n := range bot.networks {
+		n.queue.close()
+	}
+	for _, n := range bot.networks {
+		select {
+		case <-n.queue.done:
+		case <-drained.Done():
+			errs = append(errs, fmt.Errorf("%v: gave up with %d lines unsent", n.Name, n.queue.pending()))
+		}
+		if err := n.quit(bot.quitMessage); err != nil {
+			errs = append(errs, fmt.Errorf("%v: unable to quit: %v", n.Name, err))
 		}
+		if n.transcript != nil {
+			if err := n.transcript.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%v: unable to close transcript: %v", n.Name, err))
+			}
+		}
+	}
+
+	if err := bot.Flush(); err != nil {
+		errs = append(errs, fmt.Errorf("unable to save state: %v", err))
 	}
+	return errors.Join(errs...)
 }
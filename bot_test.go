@@ -0,0 +1,245 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+// newTestBot returns a bot with a single network, test, whose connection is a fake client registered as gobot. The
+// bot isn't started, so tests hand messages straight to listeners, then call flush to see what was sent. The bot's
+// RNG is seeded with 1, and it doesn't pretend to type.
+func newTestBot(t *testing.T) (*IrcBot, *Network, *irctest.Client) {
+	t.Helper()
+	scoreMap = make(map[string]Score)
+	karmaAdmin = newKarmaAdmin()
+
+	bot, err := NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.rng = rand.New(rand.NewSource(1))
+
+	n := bot.AddNetwork("test", []string{"#test"}, nil)
+	client := irctest.NewClient("gobot")
+	n.setClient(client)
+	bot.settings.Set("test", "#test", "typing-delay", "0s")
+	return bot, n, client
+}
+
+// flush sends everything in n's queue right away.
+func flush(n *Network) {
+	n.queue.drain(n.client())
+}
+
+// privmsg builds a message from nick to #test on the test network.
+func privmsg(nick, text string) irc.Message {
+	m := irc.NewMessage(fmt.Sprintf(":%v!%v@test PRIVMSG #test :%v", nick, nick, text))
+	m.Network = "test"
+	return *m
+}
+
+// startBot starts a bot connected to a fake server as gobot, in #test and #other along with alice and bob, and waits
+// for it to join. The bot is stopped when the test finishes.
+func startBot(t *testing.T) (*IrcBot, *irctest.Server) {
+	t.Helper()
+	scoreMap = make(map[string]Score)
+	karmaAdmin = newKarmaAdmin()
+
+	srv := irctest.NewServer(t)
+	for _, nick := range []string{"alice", "bob"} {
+		srv.AddUser("#test", nick)
+		srv.AddUser("#other", nick)
+	}
+
+	bot, err := NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := bot.AddNetwork("test", []string{"#test", "#other"}, srv.Connect("gobot"))
+	n.SetFloodControl(100, time.Millisecond)
+	for _, channel := range n.Channels() {
+		bot.settings.Set("test", channel, "typing-delay", "0s")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- bot.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Start() => %v", err)
+		}
+	})
+
+	srv.Expect(`^NAMES #other$`)
+	return bot, srv
+}
+
+func TestScore(t *testing.T) {
+	bot, srv := startBot(t)
+	bot.do(func() { bot.settings.Set("test", "#test", "karma-cooldown", "0s") })
+
+	srv.Say("alice", "#test", "bob++")
+	srv.Expect(`^PRIVMSG #test :bob's score is now 1$`)
+
+	srv.Say("alice", "#test", "bob--")
+	srv.Say("alice", "#test", "bob--")
+	srv.Expect(`^PRIVMSG #test :bob's score is now 0$`)
+	srv.Expect(`^PRIVMSG #test :bob's score is now -1$`)
+
+	// People who aren't here get points too, as things.
+	srv.Say("alice", "#test", "(the build)++")
+	srv.Expect(`^PRIVMSG #test :the build's score is now 1$`)
+
+	srv.Say("bob", "#test", "gobot, my score?")
+	srv.Expect(`^PRIVMSG #test :bob, your score is -1\.$`)
+}
+
+func TestSeen(t *testing.T) {
+	_, srv := startBot(t)
+
+	srv.Say("alice", "#test", "hello world")
+	srv.Say("bob", "#test", "gobot, seen alice?")
+	srv.Expect(`^PRIVMSG #test :alice was last seen just now saying "hello world" in #test\.$`)
+
+	srv.Send(":alice!alice@test QUIT :Ping timeout")
+	srv.Say("bob", "#test", "gobot, seen alice?")
+	srv.Expect(`^PRIVMSG #test :alice was last seen just now quitting \(Ping timeout\), and last spoke just now in #test: "hello world"\.$`)
+
+	srv.Say("bob", "#test", "gobot, seen carol?")
+	srv.Expect(`^PRIVMSG #test :Sorry, haven't seen carol\.$`)
+}
+
+func TestRegex(t *testing.T) {
+	_, srv := startBot(t)
+
+	srv.Say("alice", "#test", "hello wrold")
+	srv.Say("alice", "#test", "s/wrold/world/")
+	srv.Expect(`^PRIVMSG #test :alice actually meant: hello world$`)
+}
+
+func TestCombat(t *testing.T) {
+	_, srv := startBot(t)
+
+	srv.Action("alice", "#test", "kicks bob")
+	srv.Expect(`^PRIVMSG #test :alice (misses|hits|crits) bob`)
+
+	srv.Action("alice", "#test", "kicks carol")
+	srv.Expect(`^PRIVMSG #test :alice flails around\.$`)
+}
+
+func TestSleepIsPerChannel(t *testing.T) {
+	_, srv := startBot(t)
+
+	srv.Say("alice", "#test", "gobot, hush")
+	srv.Expect(`^PRIVMSG #test :OK, I'll go to sleep\. Good night\.$`)
+
+	srv.Say("alice", "#test", "gobot, uptime?")
+	srv.ExpectNone(`Uptime`, 100*time.Millisecond)
+
+	srv.Say("alice", "#other", "gobot, uptime?")
+	srv.Expect(`^PRIVMSG #other :Uptime is `)
+
+	srv.Say("alice", "#test", "gobot, wake up")
+	srv.Expect(`^PRIVMSG #test :I'm awake! I'm awake!$`)
+}
+
+func TestAdminDisable(t *testing.T) {
+	bot, srv := startBot(t)
+	bot.control <- func() {
+		bot.SetAdmins([]string{"alice"})
+	}
+
+	srv.Say("bob", "#test", "gobot, disable combat")
+	srv.Expect(`^PRIVMSG #test :Sorry bob, only admins can do that\.$`)
+
+	srv.Say("alice", "#test", "gobot, disable combat")
+	srv.Expect(`^PRIVMSG #test :OK, combat is disabled in #test\.$`)
+
+	srv.Action("alice", "#test", "kicks bob")
+	srv.ExpectNone(`bob`, 100*time.Millisecond)
+
+	srv.Action("alice", "#other", "kicks bob")
+	srv.Expect(`^PRIVMSG #other :alice (misses|hits|crits) bob`)
+}
+
+func TestReconnect(t *testing.T) {
+	_, srv := startBot(t)
+
+	srv.Hangup()
+	srv.Expect(`^NICK gobot$`)
+	srv.Expect(`^JOIN #test$`)
+	if got := srv.Dials(); got != 2 {
+		t.Errorf("Dials() => %v; want 2", got)
+	}
+}
+
+func TestReconnectForgetsMembers(t *testing.T) {
+	_, srv := startBot(t)
+
+	srv.Hangup()
+	srv.RemoveUser("#test", "bob")
+	srv.Expect(`^JOIN #test$`)
+	srv.Expect(`^NAMES #other$`)
+
+	srv.Action("alice", "#test", "kicks bob")
+	srv.Expect(`^PRIVMSG #test :alice flails around\.$`)
+}
+
+func TestReplyTypes(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	clock := irctest.NewClock(start)
+	bot.SetClock(clock)
+	bot.settings.Set("test", "#test", "typing-delay", "10ms")
+
+	bot.Reply(context.Background(), privmsg("alice", "hi"), "hello")
+	flush(n)
+
+	if got, want := clock.Since(start), 50*time.Millisecond; got != want {
+		t.Errorf("typing took %v; want %v", got, want)
+	}
+	if got := client.Said("#test"); len(got) != 1 || got[0] != "hello" {
+		t.Errorf("said %q; want just hello", got)
+	}
+}
+
+func TestTriggers(t *testing.T) {
+	bot, n, _ := newTestBot(t)
+	bot.settings.SetEnabled("test", "#test", "combat", false)
+
+	tests := []struct {
+		id   TriggerId
+		text string
+		want ResultCode
+	}{
+		{"seen", "hello world", Fired},
+		{"seen", "gobot, seen alice?", Trap},
+		{"score", "hello world", Pass},
+		// Disabled modules pass, like they do for everything else.
+		{"combat", "gobot, attack alice", Pass},
+	}
+	for _, test := range tests {
+		trigger := bot.Trigger(test.id)
+		if trigger == nil {
+			t.Errorf("Trigger(%q) => nil", test.id)
+			continue
+		}
+		if got := trigger.Fire(privmsg("alice", test.text), bot, nil); got != test.want {
+			t.Errorf("Trigger(%q).Fire(%q) => %v; want %v", test.id, test.text, got, test.want)
+		}
+	}
+	flush(n)
+
+	if got := bot.Trigger("nope"); got != nil {
+		t.Errorf("Trigger(%q) => %v; want nil", "nope", got)
+	}
+}
@@ -0,0 +1,99 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+// A module which panics breakerLimit times within breakerWindow is switched off everywhere, until an admin enables it
+// again. Required modules are never switched off; their panics are only logged.
+const (
+	breakerLimit  = 5
+	breakerWindow = 10 * time.Minute
+)
+
+// breaker tracks a module's recent panics.
+type breaker struct {
+	failures []time.Time
+	tripped  bool
+}
+
+// fire passes msg to l. If l panics, the panic is reported and the message carries on to the next module as if l
+// hadn't fired.
+func (bot *IrcBot) fire(ctx context.Context, l moduleListener, msg irc.Message) (fired, trap bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fired, trap = false, false
+			stack := debug.Stack()
+			if !l.Async {
+				bot.failed(l.Module, msg, r, stack)
+				return
+			}
+			// The breakers belong to the dispatch loop. If it's gone, there's nothing left to switch off.
+			if err := bot.do(func() { bot.failed(l.Module, msg, r, stack) }); err != nil {
+				logging.Module(l.Name).Error("Panic handling message", "network", msg.Network, "channel", msg.Channel,
+					"line", msg.Raw, "panic", r, "stack", string(stack))
+			}
+		}
+	}()
+	return l.fire(ctx, msg)
+}
+
+// failed reports a module's panic, and trips its breaker if it's been panicking too much. It runs on the dispatch
+// loop.
+func (bot *IrcBot) failed(m Module, msg irc.Message, r interface{}, stack []byte) {
+	log := logging.Module(m.Name)
+	log.Error("Panic handling message", "network", msg.Network, "channel", msg.Channel, "line", msg.Raw,
+		"panic", r, "stack", string(stack))
+	bot.metrics.panics.Inc(m.Name)
+
+	b := bot.breakers[m.Name]
+	if b == nil {
+		b = &breaker{}
+		bot.breakers[m.Name] = b
+	}
+	now := bot.clock.Now()
+	recent := b.failures[:0]
+	for _, t := range b.failures {
+		if now.Sub(t) < breakerWindow {
+			recent = append(recent, t)
+		}
+	}
+	b.failures = append(recent, now)
+
+	alert := fmt.Sprintf("%v panicked on %v: %v", m.Name, msg.Raw, r)
+	if !m.Required && len(b.failures) >= breakerLimit {
+		b.tripped = true
+		log.Error("Switching module off, it keeps panicking", "panics", len(b.failures), "window", breakerWindow)
+		alert += fmt.Sprintf(". That's %d times in %v, so I've switched it off. Say \"enable %v\" to turn it back on.",
+			len(b.failures), breakerWindow, m.Name)
+	}
+	bot.alert(msg.Network, alert)
+}
+
+// tripped reports whether the named module has been switched off for panicking.
+func (bot *IrcBot) tripped(module string) bool {
+	b := bot.breakers[module]
+	return b != nil && b.tripped
+}
+
+// resetBreaker switches a module back on after it's been tripped, and reports whether it had been.
+func (bot *IrcBot) resetBreaker(module string) bool {
+	wasTripped := bot.tripped(module)
+	delete(bot.breakers, module)
+	return wasTripped
+}
+
+// alert tells the alert nick, if there is one, about trouble on a network.
+func (bot *IrcBot) alert(network, text string) {
+	n := bot.Network(network)
+	if bot.alertNick == "" || n == nil {
+		return
+	}
+	n.Say(context.Background(), bot.alertNick, text)
+}
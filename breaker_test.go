@@ -0,0 +1,86 @@
+package youandmeandirc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestPanickingModuleIsSwitchedOff(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+	bot.alertNick = "alice"
+	bot.SetAdmins([]string{"alice"})
+
+	calls, after := 0, 0
+	bot.Register(shared("boom", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			calls++
+			var fields []string
+			_ = fields[len(fields)] // the classic
+			return true, true
+		}
+	}))
+	bot.Register(shared("after", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			after++
+			return true, false
+		}
+	}))
+
+	hi := privmsg("bob", "hi")
+	for i := 0; i < breakerLimit; i++ {
+		bot.runListeners(hi)
+		clock.Advance(time.Minute)
+	}
+	flush(n)
+	if after != breakerLimit {
+		t.Errorf("the module after boom saw %d messages; want %d", after, breakerLimit)
+	}
+	alerts := client.Said("alice")
+	if len(alerts) != breakerLimit || !strings.Contains(last(alerts), "switched it off") {
+		t.Errorf("alerts => %q; want %d, the last saying boom was switched off", alerts, breakerLimit)
+	}
+	if got := bot.metrics.panics.Value("boom"); got != breakerLimit {
+		t.Errorf("panics => %v; want %v", got, breakerLimit)
+	}
+
+	bot.runListeners(hi)
+	if calls != breakerLimit {
+		t.Errorf("boom was called %d times; want it switched off after %d", calls, breakerLimit)
+	}
+
+	bot.runListeners(privmsg("alice", "gobot, enable boom"))
+	bot.runListeners(hi)
+	if calls != breakerLimit+1 {
+		t.Errorf("boom was called %d times; want it back on after enable", calls)
+	}
+}
+
+func TestBreakerForgetsOldPanics(t *testing.T) {
+	bot, _, _ := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+	m := Module{Name: "flaky"}
+
+	for i := 0; i < 2*breakerLimit; i++ {
+		bot.failed(m, privmsg("alice", "hi"), "oops", nil)
+		clock.Advance(breakerWindow / 2)
+	}
+	if bot.tripped("flaky") {
+		t.Errorf("flaky tripped, but it never panicked more than twice in %v", breakerWindow)
+	}
+
+	m = required(Module{Name: "vital"})
+	for i := 0; i < 2*breakerLimit; i++ {
+		bot.failed(m, privmsg("alice", "hi"), "oops", nil)
+	}
+	if bot.tripped("vital") {
+		t.Errorf("vital tripped, but required modules can't be switched off")
+	}
+}
@@ -0,0 +1,23 @@
+package youandmeandirc
+
+import "github.com/wonderzombie/youandmeandirc/irc"
+
+// Client is the bot's side of a connection to a server: the commands it sends, and what it knows about itself.
+// *irc.Conn is the real thing; irctest.Client records what's sent, for tests.
+type Client interface {
+	// Nick is the nick we registered with.
+	Nick() string
+
+	Say(channel, chat string) error
+	Notice(target, text string) error
+	Join(channel string) error
+	Part(channel, message string) error
+	Names(channel string) error
+	Ping(token string) error
+	Quit(message string) error
+
+	// Close hangs up without a QUIT.
+	Close() error
+}
+
+var _ Client = (*irc.Conn)(nil)
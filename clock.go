@@ -0,0 +1,29 @@
+package youandmeandirc
+
+import "time"
+
+// Clock is where the bot gets the time from, and how it waits. Everything time-dependent goes through it, so tests
+// can use a fake one, such as irctest.Clock, instead of waiting around.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	// After sends the time on the returned channel once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetClock changes the bot's clock. It should be called before the bot starts.
+func (bot *IrcBot) SetClock(c Clock) {
+	bot.clock = c
+	for _, n := range bot.networks {
+		n.setClock(c)
+	}
+}
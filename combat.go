@@ -1,13 +1,17 @@
 package youandmeandirc
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
 )
 
+var combatLog = logging.Module("combat")
+
+// CombatTrigger fires the combat module. See Trigger.
 type CombatTrigger struct{}
 
 func (t CombatTrigger) Id() TriggerId {
@@ -15,15 +19,13 @@ func (t CombatTrigger) Id() TriggerId {
 }
 
 func (t CombatTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
-	fn := bot.combatListener()
-	fired, _ := fn(msg)
-	if fired {
-		return Fired
-	}
-	return Pass
+	return bot.fireModule("combat", msg)
 }
 
-func (bot *IrcBot) combatListener() (combat Listener) {
+func (bot *IrcBot) combatListener(n *Network, m ModuleMetrics) (combat Listener) {
+	n.health = make(map[string]int)
+	swings := m.Counter("attacks_total", "Attacks, by how they went.", "network", "result")
+
 	attacks := []string{
 		"beat",
 		"gouges",
@@ -36,7 +38,7 @@ func (bot *IrcBot) combatListener() (combat Listener) {
 		"stabs",
 	}
 
-	combat = func(msg irc.Message) (fired, trap bool) {
+	combat = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
 		if msg.Command != irc.Privmsg {
 			return
 		}
@@ -51,33 +53,31 @@ func (bot *IrcBot) combatListener() (combat Listener) {
 		if len(fields) < 3 {
 			return
 		}
-		log.Printf("Attack received: %q\n", fields)
+		combatLog.Debug("Attack received", "network", n.Name, "attacker", msg.Nick, "action", msg.Text)
 
 		// You cannot attack if you're dead.
-		attackerHp, ok := bot.healthList[msg.Nick]
+		attackerHp, ok := n.health[msg.Nick]
 		if ok && attackerHp == 0 {
 			say := fmt.Sprintf("You can't attack when you're dead, %v!", msg.Nick)
-			bot.irc.Say(msg.Channel, say)
+			n.Say(ctx, msg.Channel, say)
 			return false, true
 		}
 
 		// Is the target present?
-		log.Printf("Targets: %+v\n", bot.namesSet)
 		target := strings.TrimSpace(last(fields))
-		ok, _ = bot.namesSet[target]
-		if !ok {
-			log.Printf("Target is not present: %q\n", target)
-			bot.irc.Say(msg.Channel, fmt.Sprintf("%v flails around.", msg.Nick))
+		if !n.inChannel(msg.Channel, target) {
+			combatLog.Debug("Target isn't here", "network", n.Name, "target", target)
+			n.Say(ctx, msg.Channel, fmt.Sprintf("%v flails around.", msg.Nick))
 			return false, true
 		}
 
 		fired, trap = true, true
 
-		health, ok := bot.healthList[target]
+		health, ok := n.health[target]
 		if !ok {
-			health = 10
+			health = bot.settings.Int(msg.Network, msg.Channel, "combat-hp")
 		} else if health == 0 {
-			bot.irc.Say(msg.Channel, fmt.Sprintf("%v is already dead!", target))
+			n.Say(ctx, msg.Channel, fmt.Sprintf("%v is already dead!", target))
 			return true, true
 		}
 
@@ -88,23 +88,26 @@ func (bot *IrcBot) combatListener() (combat Listener) {
 		switch toHit {
 		case 1:
 			out = fmt.Sprintf("%v misses %v!", msg.Nick, target)
+			swings.Inc(n.Name, "miss")
 		case 6:
 			damage *= 2
 			out = fmt.Sprintf("%v crits %v for %v damage!", msg.Nick, target, damage)
+			swings.Inc(n.Name, "crit")
 		default:
 			out = fmt.Sprintf("%v hits %v for %v damage!", msg.Nick, target, damage)
+			swings.Inc(n.Name, "hit")
 		}
 
 		health -= damage
-		bot.irc.Say(msg.Channel, out)
+		n.Say(ctx, msg.Channel, out)
 
 		if health <= 0 {
 			out = fmt.Sprintf("%v has died!", target)
-			bot.irc.Say(msg.Channel, out)
+			n.Say(ctx, msg.Channel, out)
 			health = 0
 		}
 
-		bot.healthList[target] = health
+		n.health[target] = health
 		return
 	}
 	return
@@ -0,0 +1,66 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCombatListener(t *testing.T) {
+	ctx := context.Background()
+	bot, n, client := newTestBot(t)
+	n.addMember("#test", "bob", time.Time{})
+	combat := bot.combatListener(n, bot.Metrics("combat"))
+
+	// The bot's RNG is seeded with 1, so roll the same dice to know what should happen.
+	dice := rand.New(rand.NewSource(1))
+	toHit, damage := 1+dice.Int()%6, 1+dice.Int()%10
+	var want string
+	switch toHit {
+	case 1:
+		want = "alice misses bob!"
+	case 6:
+		want = fmt.Sprintf("alice crits bob for %v damage!", damage*2)
+	default:
+		want = fmt.Sprintf("alice hits bob for %v damage!", damage)
+	}
+
+	fired, trap := combat(ctx, privmsg("alice", "\x01ACTION kicks bob"))
+	if !fired || !trap {
+		t.Errorf("combat(kicks bob) => %v, %v; want true, true", fired, trap)
+	}
+	flush(n)
+	if got := client.Said("#test"); len(got) == 0 || got[0] != want {
+		t.Errorf("said %q; want %q first", got, want)
+	}
+}
+
+func TestCombatDeath(t *testing.T) {
+	ctx := context.Background()
+	bot, n, client := newTestBot(t)
+	n.addMember("#test", "bob", time.Time{})
+	n.addMember("#test", "alice", time.Time{})
+	bot.settings.Set("test", "#test", "combat-hp", "1")
+	combat := bot.combatListener(n, bot.Metrics("combat"))
+
+	// With 1 HP, the first blow that lands is fatal.
+	for i := 0; i < 20 && !has(client.Said("#test"), "bob has died!"); i++ {
+		combat(ctx, privmsg("alice", "\x01ACTION stabs bob"))
+		flush(n)
+	}
+	if !has(client.Said("#test"), "bob has died!") {
+		t.Fatalf("bob never died; said %q", client.Said("#test"))
+	}
+
+	client.Reset()
+	combat(ctx, privmsg("alice", "\x01ACTION stabs bob"))
+	combat(ctx, privmsg("bob", "\x01ACTION stabs alice"))
+	flush(n)
+	want := []string{"bob is already dead!", "You can't attack when you're dead, bob!"}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said %q; want %q", got, want)
+	}
+}
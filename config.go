@@ -0,0 +1,455 @@
+package youandmeandirc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var configLog = logging.Subsystem("config")
+
+// Config is the bot's configuration, usually read from a JSON file with ReadConfig. For example:
+//
+//	{
+//	  "nick": "gobot",
+//	  "admins": ["wonderzombie"],
+//	  "networks": [{
+//	    "name": "home",
+//	    "addr": "home.zole.org:6667",
+//	    "channels": [
+//	      {"name": "#testbot"},
+//	      {"name": "#quiet", "disable": ["combat", "replies"], "settings": {"typing-delay": "50ms"}}
+//	    ]
+//	  }]
+//	}
+type Config struct {
+	Nick     string          `json:"nick"`
+	User     string          `json:"user"`
+	RealName string          `json:"realname"`
+	Admins   []string        `json:"admins"`
+	Networks []NetworkConfig `json:"networks"`
+
+	// AlertNick is told when a module panics, on the network it happened on.
+	AlertNick string `json:"alert_nick"`
+
+	// StateDir is where module state, such as scores, is kept between runs. Changes take effect after a restart.
+	StateDir string `json:"state_dir"`
+	// QuitMessage is sent to every network on shutdown.
+	QuitMessage string `json:"quit_message"`
+	// DrainTimeout is how long to wait on shutdown for queued lines to be sent, e.g. "5s".
+	DrainTimeout string `json:"drain_timeout"`
+	// LogLevels sets how much subsystems and modules log, e.g. {"default": "warn", "conn": "debug", "score": "info"}.
+	LogLevels map[string]string `json:"log_levels"`
+	// HandlerTimeout is how long a module gets to handle a message, e.g. "10s". Anything it says after that is dropped.
+	HandlerTimeout string `json:"handler_timeout"`
+	// Timezone is where times are shown for people who haven't picked their own, e.g. "Europe/London". Schedules,
+	// and "today" and "this month" on leaderboards, go by it too. It's UTC unless set.
+	Timezone string `json:"timezone"`
+
+	// StatusAddr is where to serve the bot's state over HTTP, e.g. "127.0.0.1:6680". It has to be a loopback address.
+	// If StatusToken is set, requests have to have it. Changes take effect after a restart.
+	StatusAddr  string `json:"status_addr"`
+	StatusToken string `json:"status_token"`
+}
+
+// Defaults for Config fields.
+const (
+	defaultQuitMessage  = "why do you hate me"
+	defaultDrainTimeout = 5 * time.Second
+)
+
+// NetworkConfig describes a network to connect to. Changes to anything but the channels take effect after a restart.
+type NetworkConfig struct {
+	Name string `json:"name"`
+	Addr string `json:"addr"` // host:port
+	Pass string `json:"pass"`
+	Nick string `json:"nick"` // Overrides Config.Nick.
+
+	FloodBurst    int    `json:"flood_burst"`
+	FloodInterval string `json:"flood_interval"`
+
+	// How often to ping the server, and how long to wait for a PONG before reconnecting, e.g. "1m" and "2m".
+	PingInterval string `json:"ping_interval"`
+	PingTimeout  string `json:"ping_timeout"`
+
+	// If set, raw traffic is appended to this file, for gobot replay.
+	Record string `json:"record"`
+
+	Channels []ChannelConfig `json:"channels"`
+}
+
+// ChannelConfig is a channel to join, along with any modules to disable and settings to override there.
+type ChannelConfig struct {
+	Name     string            `json:"name"`
+	Disable  []string          `json:"disable"`
+	Settings map[string]string `json:"settings"`
+}
+
+// ReadConfig reads and checks a config file.
+func ReadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := new(Config)
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if err := cfg.Check(); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Check returns an error if anything in the config is missing or doesn't make sense.
+func (cfg *Config) Check() error {
+	if len(cfg.Networks) == 0 {
+		return fmt.Errorf("no networks")
+	}
+	if cfg.DrainTimeout != "" {
+		if _, err := time.ParseDuration(cfg.DrainTimeout); err != nil {
+			return fmt.Errorf("drain_timeout: %v", err)
+		}
+	}
+	if _, err := logging.ParseLevels(cfg.LogLevels); err != nil {
+		return err
+	}
+	if cfg.HandlerTimeout != "" {
+		if d, err := time.ParseDuration(cfg.HandlerTimeout); err != nil {
+			return fmt.Errorf("handler_timeout: %v", err)
+		} else if d <= 0 {
+			return fmt.Errorf("handler_timeout: has to be positive")
+		}
+	}
+	if cfg.Timezone != "" {
+		if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+			return fmt.Errorf("timezone: %v", err)
+		}
+	}
+	if cfg.StatusAddr != "" {
+		if err := checkLoopback(cfg.StatusAddr); err != nil {
+			return fmt.Errorf("status_addr: %v", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, nc := range cfg.Networks {
+		if nc.Name == "" {
+			return fmt.Errorf("network %v has no name", nc.Addr)
+		}
+		if seen[nc.Name] {
+			return fmt.Errorf("network %v is listed twice", nc.Name)
+		}
+		seen[nc.Name] = true
+
+		if _, _, err := net.SplitHostPort(nc.Addr); err != nil {
+			return fmt.Errorf("network %v: %v", nc.Name, err)
+		}
+		if nc.nick(cfg) == "" {
+			return fmt.Errorf("network %v: no nick", nc.Name)
+		}
+		if nc.FloodBurst < 0 {
+			return fmt.Errorf("network %v: flood_burst can't be negative", nc.Name)
+		}
+		for field, value := range map[string]string{
+			"flood_interval": nc.FloodInterval,
+			"ping_interval":  nc.PingInterval,
+			"ping_timeout":   nc.PingTimeout,
+		} {
+			if value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("network %v: %v: %v", nc.Name, field, err)
+			} else if d <= 0 {
+				return fmt.Errorf("network %v: %v has to be more than zero", nc.Name, field)
+			}
+		}
+
+		joined := make(map[string]bool)
+		for _, cc := range nc.Channels {
+			if !strings.HasPrefix(cc.Name, "#") && !strings.HasPrefix(cc.Name, "&") {
+				return fmt.Errorf("network %v: %q isn't a channel", nc.Name, cc.Name)
+			}
+			if joined[strings.ToLower(cc.Name)] {
+				return fmt.Errorf("network %v: %v is listed twice", nc.Name, cc.Name)
+			}
+			joined[strings.ToLower(cc.Name)] = true
+
+			for k, v := range cc.Settings {
+				if err := validateSetting(k, v); err != nil {
+					return fmt.Errorf("network %v, %v: %v", nc.Name, cc.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) hasNetwork(name string) bool {
+	for _, nc := range cfg.Networks {
+		if nc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (nc NetworkConfig) nick(cfg *Config) string {
+	if nc.Nick != "" {
+		return nc.Nick
+	}
+	return cfg.Nick
+}
+
+func (nc NetworkConfig) channelNames() []string {
+	var names []string
+	for _, cc := range nc.Channels {
+		names = append(names, cc.Name)
+	}
+	return names
+}
+
+// dialer returns a ConnectFn which connects to the network and registers with the server, and the transcript it
+// records to, if the network has one.
+func (nc NetworkConfig) dialer(cfg *Config) (ConnectFn, *transcript) {
+	nick, user, realname := nc.nick(cfg), cfg.User, cfg.RealName
+	if user == "" {
+		user = nick
+	}
+	if realname == "" {
+		realname = "..."
+	}
+
+	var t *transcript
+	if nc.Record != "" {
+		t = &transcript{path: nc.Record}
+	}
+	return func() (*irc.Conn, error) {
+		rec, err := t.recorder()
+		if err != nil {
+			return nil, err
+		}
+		n, err := net.DialTimeout("tcp", nc.Addr, time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		return irc.ConnectWithRecorder(n, rec, nick, realname, user, nc.Pass)
+	}, t
+}
+
+// transcript is the file a network's traffic is recorded to. It's opened on the first dial and kept open across
+// reconnects, until it's closed.
+type transcript struct {
+	path string
+
+	mu     sync.Mutex // guards the fields below
+	f      *os.File
+	rec    *irc.Recorder
+	closed bool
+}
+
+// recorder returns the Recorder for the transcript, opening the file if it isn't already. A nil transcript has a nil
+// Recorder, which records nothing.
+func (t *transcript) recorder() (*irc.Recorder, error) {
+	if t == nil {
+		return nil, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, fmt.Errorf("transcript %v is closed", t.path)
+	}
+	if t.rec == nil {
+		f, err := os.OpenFile(t.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		t.f, t.rec = f, irc.NewRecorder(f)
+	}
+	return t.rec, nil
+}
+
+// Close syncs and closes the file, if it was ever opened. Anything recorded after that is lost.
+func (t *transcript) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.f == nil {
+		return nil
+	}
+	f := t.f
+	t.f = nil
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// settingsFor builds the per-channel settings described by cfg.
+func (bot *IrcBot) settingsFor(cfg *Config) (*Settings, error) {
+	s := NewSettings()
+	for _, nc := range cfg.Networks {
+		for _, cc := range nc.Channels {
+			for _, name := range cc.Disable {
+				m, ok := bot.module(name)
+				if !ok {
+					return nil, fmt.Errorf("network %v, %v: no module called %v", nc.Name, cc.Name, name)
+				}
+				if m.Required {
+					return nil, fmt.Errorf("network %v, %v: %v can't be disabled", nc.Name, cc.Name, name)
+				}
+				s.SetEnabled(nc.Name, cc.Name, name, false)
+			}
+			for k, v := range cc.Settings {
+				if err := s.Set(nc.Name, cc.Name, k, v); err != nil {
+					return nil, fmt.Errorf("network %v, %v: %v", nc.Name, cc.Name, err)
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// Configure applies cfg to the bot. Networks are added the first time through; after that, only their channel lists
+// are updated, with the bot joining and parting to match. Per-channel settings, admins and log levels are replaced
+// wholesale, which undoes changes made by admin commands since the last time. Module state, such as scores, is kept.
+//
+// If cfg has a problem, nothing changes and an error is returned. Configure must not be called from another goroutine
+// once the bot has started; use Reload.
+func (bot *IrcBot) Configure(cfg *Config) error {
+	if err := cfg.Check(); err != nil {
+		return err
+	}
+	settings, err := bot.settingsFor(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.StateDir != "" && cfg.StateDir != bot.stateDir {
+		if bot.started {
+			configLog.Warn("Not moving state until the next restart", "state_dir", cfg.StateDir)
+		} else if err := bot.SetStateDir(cfg.StateDir); err != nil {
+			return err
+		}
+	}
+
+	for _, nc := range cfg.Networks {
+		n, ok := bot.networks[nc.Name]
+		if !ok {
+			if bot.started {
+				configLog.Warn("Not adding network until the next restart", "network", nc.Name)
+				continue
+			}
+			dial, t := nc.dialer(cfg)
+			n = bot.AddNetwork(nc.Name, nc.channelNames(), dial)
+			if t != nil {
+				n.setTranscript(t)
+			}
+			if nc.FloodBurst > 0 || nc.FloodInterval != "" {
+				burst, interval := defaultFloodBurst, defaultFloodInterval
+				if nc.FloodBurst > 0 {
+					burst = nc.FloodBurst
+				}
+				if nc.FloodInterval != "" {
+					interval, _ = time.ParseDuration(nc.FloodInterval)
+				}
+				n.SetFloodControl(burst, interval)
+			}
+			if nc.PingInterval != "" || nc.PingTimeout != "" {
+				interval, timeout := defaultPingInterval, defaultPingTimeout
+				if nc.PingInterval != "" {
+					interval, _ = time.ParseDuration(nc.PingInterval)
+				}
+				if nc.PingTimeout != "" {
+					timeout, _ = time.ParseDuration(nc.PingTimeout)
+				}
+				n.SetKeepalive(interval, timeout)
+			}
+			continue
+		}
+		n.setChannels(nc.channelNames())
+	}
+	for name := range bot.networks {
+		if !cfg.hasNetwork(name) {
+			configLog.Warn("Network is no longer configured, but stays connected until the next restart", "network", name)
+		}
+	}
+
+	bot.settings.replace(settings)
+	bot.SetAdmins(cfg.Admins)
+	bot.alertNick = cfg.AlertNick
+	logging.SetLevels(cfg.LogLevels)
+
+	bot.quitMessage = defaultQuitMessage
+	if cfg.QuitMessage != "" {
+		bot.quitMessage = cfg.QuitMessage
+	}
+	bot.drainTimeout = defaultDrainTimeout
+	if cfg.DrainTimeout != "" {
+		bot.drainTimeout, _ = time.ParseDuration(cfg.DrainTimeout)
+	}
+	bot.handlerTimeout = defaultHandlerTimeout
+	if cfg.HandlerTimeout != "" {
+		bot.handlerTimeout, _ = time.ParseDuration(cfg.HandlerTimeout)
+	}
+	bot.location = time.UTC
+	if cfg.Timezone != "" {
+		bot.location, _ = time.LoadLocation(cfg.Timezone)
+	}
+	if bot.started {
+		if cfg.StatusAddr != bot.statusAddr || cfg.StatusToken != bot.statusToken {
+			configLog.Warn("Not changing the status server until the next restart")
+		}
+	} else {
+		bot.statusAddr, bot.statusToken = cfg.StatusAddr, cfg.StatusToken
+	}
+	return nil
+}
+
+// LoadConfig reads a config file and applies it, and remembers where it came from for Reload.
+func (bot *IrcBot) LoadConfig(path string) error {
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := bot.Configure(cfg); err != nil {
+		return err
+	}
+	bot.configPath = path
+	return nil
+}
+
+// reload rereads the config file. It runs on the dispatch loop.
+func (bot *IrcBot) reload() error {
+	if bot.configPath == "" {
+		return fmt.Errorf("there's no config file to reload")
+	}
+	cfg, err := ReadConfig(bot.configPath)
+	if err != nil {
+		return err
+	}
+	return bot.Configure(cfg)
+}
+
+// Reload rereads the config file given to LoadConfig and applies it, without dropping any connections. If the file
+// has a problem, the old config stays in place. It's safe to call from any goroutine.
+func (bot *IrcBot) Reload() error {
+	var err error
+	if stopped := bot.do(func() { err = bot.reload() }); stopped != nil {
+		return stopped
+	}
+	return err
+}
@@ -0,0 +1,169 @@
+package youandmeandirc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testConfig = `{
+  "nick": "gobot",
+  "admins": ["wonderzombie"],
+  "networks": [{
+    "name": "home",
+    "addr": "home.zole.org:6667",
+    "channels": [
+      {"name": "#testbot"},
+      {"name": "#quiet", "disable": ["combat"], "settings": {"combat-hp": "20"}}
+    ]
+  }]
+}`
+
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "gobot.json")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no networks", Config{Nick: "gobot"}},
+		{"no nick", Config{Networks: []NetworkConfig{{Name: "home", Addr: "localhost:6667"}}}},
+		{"no port", Config{Nick: "gobot", Networks: []NetworkConfig{{Name: "home", Addr: "localhost"}}}},
+		{"duplicate network", Config{Nick: "gobot", Networks: []NetworkConfig{
+			{Name: "home", Addr: "localhost:6667"},
+			{Name: "home", Addr: "localhost:6668"},
+		}}},
+		{"not a channel", Config{Nick: "gobot", Networks: []NetworkConfig{
+			{Name: "home", Addr: "localhost:6667", Channels: []ChannelConfig{{Name: "testbot"}}},
+		}}},
+		{"bad setting", Config{Nick: "gobot", Networks: []NetworkConfig{
+			{Name: "home", Addr: "localhost:6667", Channels: []ChannelConfig{
+				{Name: "#testbot", Settings: map[string]string{"combat-hp": "-3"}},
+			}},
+		}}},
+		{"unknown timezone", Config{Nick: "gobot", Timezone: "Mars/Olympus_Mons", Networks: []NetworkConfig{
+			{Name: "home", Addr: "localhost:6667"},
+		}}},
+	}
+
+	for _, test := range tests {
+		if err := test.cfg.Check(); err == nil {
+			t.Errorf("Check() on config with %v => nil; want error", test.name)
+		}
+	}
+}
+
+func TestLoadConfigAndReload(t *testing.T) {
+	bot, err := NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeConfig(t, testConfig)
+	if err := bot.LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig(%q) => %v", path, err)
+	}
+
+	n := bot.Network("home")
+	if n == nil {
+		t.Fatalf("no network called home after LoadConfig")
+	}
+	if got, want := n.Channels(), []string{"#testbot", "#quiet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Channels() => %q; want %q", got, want)
+	}
+	if bot.settings.Enabled("home", "#quiet", "combat") {
+		t.Errorf("combat is enabled in #quiet; want disabled")
+	}
+	if !bot.IsAdmin("WonderZombie") {
+		t.Errorf("IsAdmin(WonderZombie) => false; want true")
+	}
+
+	// A module that doesn't exist makes the whole file invalid, so nothing should change.
+	os.WriteFile(path, []byte(`{
+  "nick": "gobot",
+  "networks": [{
+    "name": "home",
+    "addr": "home.zole.org:6667",
+    "channels": [{"name": "#elsewhere", "disable": ["nonsense"]}]
+  }]
+}`), 0600)
+	if err := bot.reload(); err == nil {
+		t.Errorf("reload() with an unknown module => nil; want error")
+	}
+	if got, want := n.Channels(), []string{"#testbot", "#quiet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Channels() after failed reload => %q; want %q", got, want)
+	}
+	if !bot.IsAdmin("wonderzombie") {
+		t.Errorf("failed reload dropped the admins")
+	}
+
+	os.WriteFile(path, []byte(`{
+  "nick": "gobot",
+  "networks": [{
+    "name": "home",
+    "addr": "home.zole.org:6667",
+    "channels": [{"name": "#quiet"}, {"name": "#new"}]
+  }]
+}`), 0600)
+	if err := bot.reload(); err != nil {
+		t.Fatalf("reload() => %v", err)
+	}
+	if got, want := n.Channels(), []string{"#quiet", "#new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Channels() after reload => %q; want %q", got, want)
+	}
+	if !bot.settings.Enabled("home", "#quiet", "combat") {
+		t.Errorf("combat is still disabled in #quiet after reload")
+	}
+	if bot.IsAdmin("wonderzombie") {
+		t.Errorf("wonderzombie is still an admin after reload")
+	}
+}
+
+func TestReadConfigUnknownField(t *testing.T) {
+	path := writeConfig(t, `{"nick": "gobot", "nework": []}`)
+	if _, err := ReadConfig(path); err == nil {
+		t.Errorf("ReadConfig with a misspelled field => nil; want error")
+	}
+}
+
+func TestTranscriptClosedOnShutdown(t *testing.T) {
+	bot, err := NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := filepath.Join(t.TempDir(), "home.log")
+	path := writeConfig(t, fmt.Sprintf(`{
+  "nick": "gobot",
+  "networks": [{"name": "home", "addr": "home.zole.org:6667", "record": %q}]
+}`, record))
+	if err := bot.LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig(%q) => %v", path, err)
+	}
+
+	tr, ok := bot.Network("home").transcript.(*transcript)
+	if !ok {
+		t.Fatalf("home has no transcript")
+	}
+	if _, err := tr.recorder(); err != nil {
+		t.Fatalf("opening the transcript => %v", err)
+	}
+
+	// The bot never started, so nothing drains the send queue; don't wait for it.
+	bot.drainTimeout = time.Millisecond
+	bot.shutdown()
+	if tr.f != nil {
+		t.Errorf("transcript is still open after shutdown")
+	}
+	if _, err := tr.recorder(); err == nil {
+		t.Errorf("reopening the transcript after shutdown => nil; want error")
+	}
+}
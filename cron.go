@@ -0,0 +1,160 @@
+package youandmeandirc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence is when a recurring job runs.
+type recurrence interface {
+	// next is the first time after t that the job should run.
+	next(t time.Time) time.Time
+}
+
+// parseRecurrence parses how often a job should run. That's either a duration, as in "@every 90m", one of @hourly,
+// @daily, @weekly (Sunday at midnight) or @monthly, or a cron-style list of minute, hour, day of the month, month and
+// day of the week, e.g. "30 9 * * 1-5" for half past nine on weekdays. Fields can be *, numbers, ranges, lists and
+// steps, as in "*/15" or "1,15". Times are in the bot's timezone, as configured; see IrcBot.SetLocation.
+func parseRecurrence(spec string) (recurrence, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, err
+		}
+		if every < time.Minute {
+			return nil, fmt.Errorf("%q is too often, the most is once a minute", spec)
+		}
+		return interval(every), nil
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%q should be minute, hour, day of month, month and day of week", spec)
+	}
+	var c cron
+	for i, f := range []struct {
+		set      *[]bool
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 6},
+	} {
+		set, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", spec, err)
+		}
+		*f.set = set
+	}
+	// Like cron, if both days are restricted, either will do.
+	c.anyDay = fields[2] == "*" || fields[4] == "*"
+	return c, nil
+}
+
+// interval is a recurrence every so often.
+type interval time.Duration
+
+func (i interval) next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// cron is a recurrence on particular minutes, hours and days. Each field has a bool for every value it can take.
+type cron struct {
+	minute, hour, dom, month, dow []bool
+	anyDay                        bool
+}
+
+func (c cron) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every combination comes around within a few years, Feb 29th on a Monday included.
+	for end := t.AddDate(8, 0, 0); t.Before(end); {
+		switch {
+		case !c.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	// Only something like "0 0 31 2 *" gets here.
+	return time.Time{}
+}
+
+func (c cron) day(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parseCronField parses one field of a cron spec, whose values run from min to max.
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if r, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad step in %q", part)
+			}
+			rng, step = r, n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("%q isn't a number", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("%q isn't a number", to)
+				}
+			} else if step > 1 {
+				// "5/15" means from 5, every 15.
+				hi = max
+			}
+		}
+		// Sunday can be 7, too.
+		if max == 6 && hi == 7 {
+			if lo == 7 {
+				lo, hi = 0, 0
+			} else {
+				if (7-lo)%step == 0 {
+					set[0] = true
+				}
+				hi = 6
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of range, it has to be within %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
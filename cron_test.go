@@ -0,0 +1,62 @@
+package youandmeandirc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	// A Monday.
+	from := time.Date(2026, 10, 19, 12, 34, 56, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90m", from.Add(90 * time.Minute)},
+		{"@hourly", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2026, 10, 19, 12, 35, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 19, 12, 45, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, 10, 20, 9, 30, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2026, 10, 25, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day will do when both are given.
+		{"0 0 1 * 2", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		r, err := parseRecurrence(test.spec)
+		if err != nil {
+			t.Errorf("parseRecurrence(%q) => %v", test.spec, err)
+			continue
+		}
+		if got := r.next(from); !got.Equal(test.want) {
+			t.Errorf("parseRecurrence(%q).next(%v) => %v; want %v", test.spec, from, got, test.want)
+		}
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"@yearly-ish",
+		"@every 10s",
+		"@every soon",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := parseRecurrence(spec); err == nil {
+			t.Errorf("parseRecurrence(%q) => no error", spec)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package youandmeandirc
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var exportLog = logging.Subsystem("export")
+
+// History is the bot's memory in a form that can be moved between bots: every karma point, and who was last seen
+// where. See Export and Import.
+type History struct {
+	Exported time.Time
+	Points   []PointRecord
+	Seen     []SeenRecord
+}
+
+// PointRecord is one karma point, with what it was given to.
+type PointRecord struct {
+	Target  string
+	Person  bool
+	Granter string
+	When    time.Time
+	Delta   int // +1 or -1.
+	Reason  string
+	// Network is where it was given. It's empty for points from before that was recorded.
+	Network string
+}
+
+// SeenRecord is the last time someone was seen doing one kind of thing on a network. See Sighting.
+type SeenRecord struct {
+	Network  string
+	Nick     string
+	Activity Activity
+	When     time.Time
+	Channel  string
+	Text     string
+	Other    string
+}
+
+// Export copies out everything in History. Points come grouped by target and in order, and seen records by network
+// and nick, so that exports of the same bot can be diffed.
+func (bot *IrcBot) Export() History {
+	h := History{Exported: bot.clock.Now()}
+
+	targets := make([]string, 0, len(scoreMap))
+	for target := range scoreMap {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		score := scoreMap[target]
+		for _, p := range score.Points {
+			delta := -1
+			if p.Increase {
+				delta = 1
+			}
+			h.Points = append(h.Points, PointRecord{target, score.Person, p.Granter, p.When, delta, p.Reason, p.Network})
+		}
+	}
+
+	for _, name := range bot.networkNames() {
+		n := bot.networks[name]
+		nicks := make([]string, 0, len(n.seen))
+		for nick := range n.seen {
+			nicks = append(nicks, nick)
+		}
+		sort.Strings(nicks)
+		for _, nick := range nicks {
+			for _, a := range activities {
+				if s, ok := n.seen[nick][a]; ok {
+					h.Seen = append(h.Seen, SeenRecord{name, nick, a, s.When, s.Channel, s.Text, s.Other})
+				}
+			}
+		}
+	}
+	return h
+}
+
+// networkNames returns the names of the bot's networks, sorted.
+func (bot *IrcBot) networkNames() []string {
+	names := make([]string, 0, len(bot.networks))
+	for name := range bot.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ImportCounts says what Import made of a History.
+type ImportCounts struct {
+	Points     int // New points.
+	Duplicates int // Points which were already here.
+	Seen       int // Seen records newer than what was here.
+	Stale      int // Seen records which were older, or for a network this bot doesn't have.
+}
+
+func (c ImportCounts) String() string {
+	return fmt.Sprintf("%v new points (%v already here), %v seen records (%v skipped)", c.Points, c.Duplicates, c.Seen,
+		c.Stale)
+}
+
+// pointKey identifies a point, for telling whether it's already been imported: the same granter on a network can't
+// give the same target two points in the same instant.
+type pointKey struct {
+	when                     int64
+	network, granter, target string
+}
+
+// Import merges h into the bot's memory. Points already here, going by when and where they were given, who by and who
+// to, are skipped, and so are seen records older than what the bot has, so importing the same thing twice changes
+// nothing.
+func (bot *IrcBot) Import(h History) ImportCounts {
+	var counts ImportCounts
+
+	have := make(map[pointKey]bool)
+	for target, score := range scoreMap {
+		for _, p := range score.Points {
+			have[pointKey{p.When.UnixNano(), p.Network, strings.ToLower(p.Granter), strings.ToLower(target)}] = true
+		}
+	}
+	changed := make(map[string]bool)
+	for _, rec := range h.Points {
+		target := scoreKey(rec.Target)
+		key := pointKey{rec.When.UnixNano(), rec.Network, strings.ToLower(rec.Granter), strings.ToLower(target)}
+		if have[key] {
+			counts.Duplicates++
+			continue
+		}
+		have[key] = true
+		score := scoreMap[target]
+		score.Total += rec.Delta
+		score.Person = score.Person || rec.Person
+		score.Points = append(score.Points,
+			Point{Granter: rec.Granter, When: rec.When, Reason: rec.Reason, Increase: rec.Delta > 0, Network: rec.Network})
+		scoreMap[target] = score
+		changed[target] = true
+		counts.Points++
+	}
+	for target := range changed {
+		points := scoreMap[target].Points
+		sort.SliceStable(points, func(i, j int) bool { return points[i].When.Before(points[j].When) })
+	}
+
+	for _, rec := range h.Seen {
+		n := bot.Network(rec.Network)
+		if n == nil || n.seen == nil || !rec.When.After(n.seen[rec.Nick][rec.Activity].When) {
+			counts.Stale++
+			continue
+		}
+		if n.seen[rec.Nick] == nil {
+			n.seen[rec.Nick] = make(SeenInfo)
+		}
+		n.seen[rec.Nick][rec.Activity] = Sighting{rec.When, rec.Channel, rec.Text, rec.Other}
+		counts.Seen++
+	}
+
+	exportLog.Info("Imported history", "points", counts.Points, "duplicates", counts.Duplicates, "seen", counts.Seen,
+		"stale", counts.Stale)
+	return counts
+}
+
+// WriteJSON writes all of h to w.
+func (h History) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
+
+// CSV has room for one table per file, so h is written a table at a time: "karma" for points, or "seen".
+var (
+	karmaHeader = []string{"target", "person", "granter", "when", "delta", "reason", "network"}
+	seenHeader  = []string{"network", "nick", "activity", "when", "channel", "text", "other"}
+	// oldKarmaHeader is karma's header from before points had a network. Files with it can still be read.
+	oldKarmaHeader = karmaHeader[:len(karmaHeader)-1]
+)
+
+// WriteCSV writes one of h's tables to w, karma or seen, with a header row.
+func (h History) WriteCSV(w io.Writer, table string) error {
+	cw := csv.NewWriter(w)
+	switch table {
+	case "karma":
+		cw.Write(karmaHeader)
+		for _, p := range h.Points {
+			cw.Write([]string{p.Target, strconv.FormatBool(p.Person), p.Granter, p.When.Format(time.RFC3339Nano),
+				strconv.Itoa(p.Delta), p.Reason, p.Network})
+		}
+	case "seen":
+		cw.Write(seenHeader)
+		for _, s := range h.Seen {
+			cw.Write([]string{s.Network, s.Nick, string(s.Activity), s.When.Format(time.RFC3339Nano), s.Channel, s.Text,
+				s.Other})
+		}
+	default:
+		return fmt.Errorf("no table called %q; want karma or seen", table)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadHistory reads what WriteJSON or WriteCSV wrote, as format "json" or "csv". Which table a CSV file holds is
+// worked out from its header.
+func ReadHistory(r io.Reader, format string) (History, error) {
+	var h History
+	switch format {
+	case "json":
+		err := json.NewDecoder(r).Decode(&h)
+		return h, err
+	case "csv":
+	default:
+		return h, fmt.Errorf("unknown format %q; want json or csv", format)
+	}
+
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return h, err
+	}
+	if len(rows) == 0 {
+		return h, nil
+	}
+	header := strings.Join(rows[0], ",")
+	for i, row := range rows[1:] {
+		line := i + 2
+		switch header {
+		case strings.Join(karmaHeader, ","), strings.Join(oldKarmaHeader, ","):
+			person, err := strconv.ParseBool(row[1])
+			if err != nil {
+				return h, fmt.Errorf("line %v: bad person: %v", line, err)
+			}
+			when, err := time.Parse(time.RFC3339Nano, row[3])
+			if err != nil {
+				return h, fmt.Errorf("line %v: bad time: %v", line, err)
+			}
+			delta, err := strconv.Atoi(row[4])
+			if err != nil || (delta != 1 && delta != -1) {
+				return h, fmt.Errorf("line %v: delta %q isn't 1 or -1", line, row[4])
+			}
+			rec := PointRecord{row[0], person, row[2], when, delta, row[5], ""}
+			if len(row) > 6 {
+				rec.Network = row[6]
+			}
+			h.Points = append(h.Points, rec)
+		case strings.Join(seenHeader, ","):
+			when, err := time.Parse(time.RFC3339Nano, row[3])
+			if err != nil {
+				return h, fmt.Errorf("line %v: bad time: %v", line, err)
+			}
+			h.Seen = append(h.Seen, SeenRecord{row[0], row[1], Activity(row[2]), when, row[4], row[5], row[6]})
+		default:
+			return h, fmt.Errorf("header %q isn't karma's or seen's", header)
+		}
+	}
+	return h, nil
+}
+
+// OpenState returns a bot which won't connect anywhere, with the state in dir loaded, for exporting from or importing
+// into. Seen tables are kept per network, so it has every network with one in dir, plus networks.
+func OpenState(dir string, networks ...string) (*IrcBot, error) {
+	bot, err := NewBot()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "seen-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		networks = append(networks, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "seen-"), ".json"))
+	}
+	for _, name := range networks {
+		if bot.Network(name) == nil {
+			bot.AddNetwork(name, nil, nil)
+		}
+	}
+	if err := bot.SetStateDir(dir); err != nil {
+		return nil, err
+	}
+	return bot, nil
+}
+
+// exportToStateDir writes the bot's history to a timestamped JSON file under the state directory's exports directory,
+// and returns its path.
+func (bot *IrcBot) exportToStateDir(h History) (string, error) {
+	if bot.stateDir == "" {
+		return "", fmt.Errorf("there's no state directory to write to")
+	}
+	dir := filepath.Join(bot.stateDir, "exports")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "history-"+h.Exported.UTC().Format("20060102-150405")+".json")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	if err := h.WriteJSON(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
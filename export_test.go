@@ -0,0 +1,170 @@
+package youandmeandirc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+// testHistory is a little of everything: points for a person and a thing, one from before points had a network, and
+// someone seen on the test network.
+func testHistory() History {
+	when := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	return History{
+		Exported: when.Add(time.Hour),
+		Points: []PointRecord{
+			{"bob", true, "alice", when, 1, "fixing the build", "test"},
+			{"bob", true, "carol", when.Add(time.Minute), -1, "", "other"},
+			{"the build", false, "bob", when.Add(2 * time.Minute), 1, "going green, \"finally\"", ""},
+		},
+		Seen: []SeenRecord{
+			{"test", "alice", Spoke, when, "#test", "bob++ for fixing the build", ""},
+			{"test", "bob", Kicked, when, "#test", "spam, \"probably\"", "alice"},
+		},
+	}
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	want := testHistory()
+
+	var b bytes.Buffer
+	if err := want.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadHistory(&b, "json")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON round trip => %+v, %v; want %+v", got, err, want)
+	}
+
+	// CSV has a table per file, and no export time.
+	got = History{}
+	for _, table := range []string{"karma", "seen"} {
+		b.Reset()
+		if err := want.WriteCSV(&b, table); err != nil {
+			t.Fatal(err)
+		}
+		h, err := ReadHistory(&b, "csv")
+		if err != nil {
+			t.Fatalf("reading %v CSV => %v", table, err)
+		}
+		got.Points = append(got.Points, h.Points...)
+		got.Seen = append(got.Seen, h.Seen...)
+	}
+	want.Exported = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CSV round trip => %+v; want %+v", got, want)
+	}
+
+	// Karma tables from before points had a network can still be read.
+	old := "target,person,granter,when,delta,reason\nbob,true,alice,2024-05-01T12:00:00.0000005Z,1,fixing the build\n"
+	got, err = ReadHistory(strings.NewReader(old), "csv")
+	if wantOld := []PointRecord{{"bob", true, "alice", want.Points[0].When, 1, "fixing the build", ""}}; err != nil ||
+		!reflect.DeepEqual(got.Points, wantOld) {
+		t.Errorf("reading an old karma CSV => %+v, %v; want %+v", got.Points, err, wantOld)
+	}
+
+	for _, bad := range []string{"name,score\nbob,1\n", "target,person,granter,when,delta,reason\nbob,true,alice,now,1,\n"} {
+		if h, err := ReadHistory(strings.NewReader(bad), "csv"); err == nil {
+			t.Errorf("ReadHistory(%q) => %+v; want error", bad, h)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	bot, n, _ := newTestBot(t)
+	h := testHistory()
+
+	// Some of it is here already: one of bob's points, and a later sighting of alice.
+	point := Point{Granter: "alice", When: h.Points[0].When, Reason: "fixing the build", Increase: true,
+		Network: "test"}
+	scoreMap["Bob"] = Score{Total: 1, Points: []Point{point}}
+	later := SeenInfo{Spoke: {When: h.Seen[0].When.Add(time.Hour), Channel: "#test", Text: "hi"}}
+	n.seen["alice"] = later
+
+	want := ImportCounts{Points: 2, Duplicates: 1, Seen: 1, Stale: 1}
+	if got := bot.Import(h); got != want {
+		t.Errorf("Import() => %+v; want %+v", got, want)
+	}
+	if got := scoreMap["Bob"]; got.Total != 0 || len(got.Points) != 2 || !got.Person {
+		t.Errorf("Bob's score => %+v; want 0 from 2 points, as a person", got)
+	}
+	if got := scoreMap["the build"]; got.Total != 1 || got.Person {
+		t.Errorf("the build's score => %+v; want 1, as a thing", got)
+	}
+	// Imported points count toward the granter's limits on the network they were given on.
+	if got := scoreMap["Bob"].Points[1].Network; got != "other" {
+		t.Errorf("carol's point for Bob was given on %q; want other", got)
+	}
+	if !reflect.DeepEqual(n.seen["alice"], later) {
+		t.Errorf("alice was last seen %+v; want the later %+v", n.seen["alice"], later)
+	}
+
+	// Doing it again changes nothing.
+	want = ImportCounts{Duplicates: 3, Stale: 2}
+	if got := bot.Import(h); got != want {
+		t.Errorf("Import() again => %+v; want %+v", got, want)
+	}
+	if got := scoreMap["Bob"].Total; got != 0 {
+		t.Errorf("Bob's score after importing again => %v; want 0", got)
+	}
+}
+
+func TestOpenState(t *testing.T) {
+	dir := t.TempDir()
+	bot, _, _ := newTestBot(t)
+	if err := bot.SetStateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	bot.Import(testHistory())
+	if err := bot.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	scoreMap = make(map[string]Score)
+	opened, err := OpenState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := opened.Export()
+	if len(h.Points) != 3 || len(h.Seen) != 2 || h.Seen[0].Network != "test" {
+		t.Errorf("OpenState(%q).Export() => %+v; want 3 points and two sightings on test", dir, h)
+	}
+}
+
+func TestAdminExport(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	dir := t.TempDir()
+	if err := bot.SetStateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	bot.SetClock(irctest.NewClock(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)))
+	bot.SetAdmins([]string{"alice"})
+	bot.Import(testHistory())
+
+	bot.runListeners(privmsg("alice", "gobot, export"))
+	flush(n)
+
+	if got, want := client.Said("#test"), []string{"OK alice, I've sent you the details."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("said in #test %q; want %q", got, want)
+	}
+	path := filepath.Join(dir, "exports", "history-20240502-000000.json")
+	want := []string{fmt.Sprintf("Exported 3 points and 2 seen records to %v.", path)}
+	if got := client.Said("alice"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said to alice %q; want %q", got, want)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if h, err := ReadHistory(f, "json"); err != nil || len(h.Points) != 3 {
+		t.Errorf("reading the export => %+v, %v; want 3 points", h, err)
+	}
+}
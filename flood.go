@@ -0,0 +1,146 @@
+package youandmeandirc
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults for flood control. Most servers will kick a client that sends more than a handful of lines in a burst.
+const (
+	defaultFloodBurst    = 4
+	defaultFloodInterval = 2 * time.Second
+)
+
+// floodGate is a token bucket. Up to burst lines can go out back to back, after which lines are released one
+// every interval.
+type floodGate struct {
+	burst    int
+	interval time.Duration
+
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token for a line sent at now and reports how long the caller should wait before sending it.
+func (g *floodGate) reserve(now time.Time) time.Duration {
+	if g.last.IsZero() {
+		g.tokens = float64(g.burst)
+		g.last = now
+	}
+
+	g.tokens += float64(now.Sub(g.last)) / float64(g.interval)
+	if g.tokens > float64(g.burst) {
+		g.tokens = float64(g.burst)
+	}
+	g.last = now
+
+	// Going negative means we're in debt; the wait pays it back.
+	g.tokens--
+	if g.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-g.tokens * float64(g.interval))
+}
+
+// outbound is a single queued write to the server.
+type outbound func(c Client) error
+
+// sendQueue releases queued writes to a network's current connection no faster than its floodGate allows.
+type sendQueue struct {
+	lines chan outbound
+	clock Clock
+
+	mu   sync.Mutex // guards gate, which can be changed while run is sending
+	gate floodGate
+
+	closing chan struct{} // closed to ask run to finish up
+	done    chan struct{} // closed by run once it has
+}
+
+func newSendQueue(burst int, interval time.Duration) *sendQueue {
+	return &sendQueue{
+		lines:   make(chan outbound, 128),
+		gate:    floodGate{burst: burst, interval: interval},
+		clock:   realClock{},
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// push queues a write. Once the queue is closing, new writes are dropped.
+func (q *sendQueue) push(fn outbound) {
+	select {
+	case q.lines <- fn:
+	case <-q.closing:
+		netLog.Warn("Send queue is closing, dropping outbound line")
+	}
+}
+
+// setGate replaces the queue's flood control. Lines already waiting on the old gate still wait out their turn.
+func (q *sendQueue) setGate(g floodGate) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.gate = g
+}
+
+// pending is how many writes are waiting to go out.
+func (q *sendQueue) pending() int {
+	return len(q.lines)
+}
+
+// close asks run to send whatever is already queued and then stop. Wait for done to know when it has.
+func (q *sendQueue) close() {
+	close(q.closing)
+}
+
+// run sends queued writes until the queue is closed and empty. conn returns the connection to write to, or nil if
+// there isn't one, in which case the line is dropped.
+func (q *sendQueue) run(name string, conn func() Client) {
+	defer close(q.done)
+	for {
+		select {
+		case fn := <-q.lines:
+			q.send(name, conn, fn)
+		case <-q.closing:
+			for {
+				select {
+				case fn := <-q.lines:
+					q.send(name, conn, fn)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// drain writes everything queued so far straight to c, ignoring flood control. It's for when there's no run loop,
+// such as when replaying a transcript.
+func (q *sendQueue) drain(c Client) {
+	for {
+		select {
+		case fn := <-q.lines:
+			if err := fn(c); err != nil {
+				netLog.Warn("Unable to write queued line", "err", err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (q *sendQueue) send(name string, conn func() Client, fn outbound) {
+	q.mu.Lock()
+	wait := q.gate.reserve(q.clock.Now())
+	q.mu.Unlock()
+	q.clock.Sleep(wait)
+
+	c := conn()
+	if c == nil {
+		netLog.Warn("Not connected, dropping outbound line", "network", name)
+		return
+	}
+	if err := fn(c); err != nil {
+		netLog.Warn("Unable to write to server", "network", name, "err", err)
+	}
+}
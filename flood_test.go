@@ -0,0 +1,35 @@
+package youandmeandirc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFloodGate(t *testing.T) {
+	start := time.Unix(0, 0)
+	tests := []struct {
+		at   time.Duration // offset from start
+		want time.Duration
+	}{
+		// The burst goes out right away.
+		{0, 0},
+		{0, 0},
+		// Then one per interval.
+		{0, time.Second},
+		{0, 2 * time.Second},
+		// Waiting pays back the debt.
+		{3 * time.Second, 0},
+		// A long quiet spell only refills up to the burst.
+		{time.Minute, 0},
+		{time.Minute, 0},
+		{time.Minute, time.Second},
+	}
+
+	g := floodGate{burst: 2, interval: time.Second}
+	for i, test := range tests {
+		got := g.reserve(start.Add(test.at))
+		if got != test.want {
+			t.Errorf("reserve #%d at %v => %v; want %v", i, test.at, got, test.want)
+		}
+	}
+}
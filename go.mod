@@ -1,3 +1,3 @@
 module github.com/wonderzombie/youandmeandirc
 
-go 1.20
\ No newline at end of file
+go 1.21
\ No newline at end of file
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	irclib "github.com/wonderzombie/youandmeandirc"
+)
+
+// stateDir works out which state directory gobot export or import means: -state, or else the config's.
+func stateDir(dir, config string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	if config == "" {
+		return "", fmt.Errorf("need -state or -config")
+	}
+	cfg, err := irclib.ReadConfig(config)
+	if err != nil {
+		return "", err
+	}
+	if cfg.StateDir == "" {
+		return "", fmt.Errorf("%v has no state_dir", config)
+	}
+	return cfg.StateDir, nil
+}
+
+// exportHistory runs gobot export: it writes every karma point and the seen tables kept in a state directory, as
+// JSON, or one table at a time as CSV.
+//
+//	gobot export [-state dir | -config gobot.json] [-format json|csv] [-table karma|seen] [-o file]
+func exportHistory(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	state := fs.String("state", "", "State directory to export from.")
+	config := fs.String("config", "", "JSON config file, to find the state directory in, if -state isn't given.")
+	format := fs.String("format", "json", "json, or csv for one table.")
+	table := fs.String("table", "karma", "Table to write as CSV: karma or seen.")
+	out := fs.String("o", "", "File to write to, rather than stdout.")
+	if err := fs.Parse(args); err != nil {
+		return exitConfig
+	}
+	dir, err := stateDir(*state, *config)
+	if err != nil || fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: gobot export [-state dir | -config file] [-format json|csv] [-table karma|seen] [-o file]")
+		return exitConfig
+	}
+
+	bot, err := irclib.OpenState(dir)
+	if err != nil {
+		mainLog.Error("Unable to load state", "dir", dir, "err", err)
+		return exitConfig
+	}
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			mainLog.Error("Unable to create export", "err", err)
+			return exitConfig
+		}
+		defer w.Close()
+	}
+
+	h := bot.Export()
+	switch *format {
+	case "json":
+		err = h.WriteJSON(w)
+	case "csv":
+		err = h.WriteCSV(w, *table)
+	default:
+		err = fmt.Errorf("unknown format %q; want json or csv", *format)
+	}
+	if err != nil {
+		mainLog.Error("Unable to export", "err", err)
+		return exitConfig
+	}
+	return exitOK
+}
+
+// importHistory runs gobot import: it merges files written by gobot export, from this bot or another, into a state
+// directory. Points and sightings already there are skipped, so it's safe to run again. The bot shouldn't be running,
+// or it'll write over the import when it stops.
+//
+//	gobot import [-state dir | -config gobot.json] [-format json|csv] file...
+func importHistory(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	state := fs.String("state", "", "State directory to import into.")
+	config := fs.String("config", "", "JSON config file, to find the state directory in, if -state isn't given.")
+	format := fs.String("format", "", "json or csv. Defaults to going by each file's extension.")
+	if err := fs.Parse(args); err != nil {
+		return exitConfig
+	}
+	dir, err := stateDir(*state, *config)
+	if err != nil || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gobot import [-state dir | -config file] [-format json|csv] file...")
+		return exitConfig
+	}
+
+	var histories []irclib.History
+	var networks []string
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			mainLog.Error("Unable to open import", "err", err)
+			return exitConfig
+		}
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		}
+		h, err := irclib.ReadHistory(f, fileFormat)
+		f.Close()
+		if err != nil {
+			mainLog.Error("Unable to read import", "path", path, "err", err)
+			return exitConfig
+		}
+		histories = append(histories, h)
+		for _, s := range h.Seen {
+			networks = append(networks, s.Network)
+		}
+	}
+
+	bot, err := irclib.OpenState(dir, networks...)
+	if err != nil {
+		mainLog.Error("Unable to load state", "dir", dir, "err", err)
+		return exitConfig
+	}
+	for i, h := range histories {
+		fmt.Printf("%v: %v.\n", fs.Arg(i), bot.Import(h))
+	}
+	if err := bot.Flush(); err != nil {
+		mainLog.Error("Unable to save state", "dir", dir, "err", err)
+		return exitShutdown
+	}
+	return exitOK
+}
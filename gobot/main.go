@@ -1,21 +1,78 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
-	"time"
+	"syscall"
 
 	irclib "github.com/wonderzombie/youandmeandirc"
-	irc "github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
 )
 
+var mainLog = logging.Subsystem("main")
+
 // Bot layer.
 func hasMyName(msg string) bool {
 	return strings.Contains(msg, *nick)
 }
 
+// networkSpec describes one network to connect to, as given to -network.
+type networkSpec struct {
+	name     string
+	addr     string
+	channels []string
+}
+
+// parseNetworkSpec parses name=host:port/#chan1,#chan2. The channel list is optional.
+func parseNetworkSpec(s string) (networkSpec, error) {
+	var spec networkSpec
+	eq := strings.Index(s, "=")
+	if eq <= 0 {
+		return spec, fmt.Errorf("network %q has no name; want name=host:port/#channel", s)
+	}
+	spec.name, s = s[:eq], s[eq+1:]
+
+	if slash := strings.Index(s, "/"); slash != -1 {
+		for _, c := range strings.Split(s[slash+1:], ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				spec.channels = append(spec.channels, c)
+			}
+		}
+		s = s[:slash]
+	}
+
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		return spec, fmt.Errorf("network %q: %v", spec.name, err)
+	}
+	spec.addr = s
+	return spec, nil
+}
+
+// networkList is a repeatable flag of network specs.
+type networkList []networkSpec
+
+func (l *networkList) String() string {
+	var names []string
+	for _, spec := range *l {
+		names = append(names, spec.name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (l *networkList) Set(s string) error {
+	spec, err := parseNetworkSpec(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, spec)
+	return nil
+}
+
 // Flags.
 var (
 	channel  = flag.String("channel", "#testbot", "Channel to join automatically.")
@@ -24,30 +81,133 @@ var (
 	username = flag.String("user", "", "Username for identification.")
 	host     = flag.String("host", "home.zole.org", "Name of IRC host.")
 	port     = flag.String("port", "6667", "Port to connect to on host.")
+	admins   = flag.String("admins", "", "Comma-separated nicks allowed to run admin commands.")
+	alert    = flag.String("alert", "", "Nick to tell when a module panics.")
+	config   = flag.String("config", "", "JSON config file. If given, the other flags are ignored, and SIGHUP rereads it.")
+	state    = flag.String("state", "", "Directory to keep scores and such in between runs.")
+	quit     = flag.String("quit", "", "Message to send when quitting.")
+	logLevel = flag.String("log", "", "Log levels, e.g. debug or warn,conn=debug,score=info. A bare level sets the default.")
+	status   = flag.String("status", "", "Loopback address to serve the bot's state on over HTTP, e.g. 127.0.0.1:6680.")
+	token    = flag.String("status-token", "", "Token the status server asks for, if any.")
+	record   = flag.String("record", "", "File to append raw traffic to, for gobot replay. Use one network per file.")
+	networks networkList
 )
 
 func init() {
-	flag.Parse()
+	flag.Var(&networks, "network", "Network to connect to, as name=host:port/#chan1,#chan2. May be repeated. Overrides -host, -port and -channel.")
 }
 
+// flagConfig builds a config from the command line flags.
+func flagConfig() *irclib.Config {
+	cfg := &irclib.Config{
+		Nick:        *nick,
+		User:        *username,
+		StateDir:    *state,
+		QuitMessage: *quit,
+		AlertNick:   *alert,
+		StatusAddr:  *status,
+		StatusToken: *token,
+	}
+	if *admins != "" {
+		cfg.Admins = strings.Split(*admins, ",")
+	}
+	if *logLevel != "" {
+		cfg.LogLevels = parseLogLevels(*logLevel)
+	}
+
+	if len(networks) == 0 {
+		networks = networkList{{
+			name:     *host,
+			addr:     net.JoinHostPort(*host, *port),
+			channels: []string{*channel},
+		}}
+	}
+	for _, spec := range networks {
+		nc := irclib.NetworkConfig{Name: spec.name, Addr: spec.addr, Pass: *pass, Record: *record}
+		for _, c := range spec.channels {
+			nc.Channels = append(nc.Channels, irclib.ChannelConfig{Name: c})
+		}
+		cfg.Networks = append(cfg.Networks, nc)
+	}
+	return cfg
+}
+
+// parseLogLevels parses -log, e.g. "warn,conn=debug", into levels by name. Whether the levels make sense is up to
+// Config.Check.
+func parseLogLevels(s string) map[string]string {
+	levels := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		name, level, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			name, level = logging.Default, name
+		}
+		levels[name] = level
+	}
+	return levels
+}
+
+// reloadOnHangup rereads the config file whenever the process gets SIGHUP.
+func reloadOnHangup(bot *irclib.IrcBot) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		mainLog.Info("Got SIGHUP, reloading", "config", *config)
+		if err := bot.Reload(); err != nil {
+			mainLog.Error("Unable to reload, keeping the old config", "err", err)
+		}
+	}
+}
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitShutdown = 1 // Something went wrong shutting down, e.g. state couldn't be saved.
+	exitConfig   = 2 // The bot couldn't start because of bad flags or config.
+	exitDiffers  = 1 // gobot replay: the bot doesn't say what it said when the transcript was recorded.
+)
+
 func main() {
-	log.Println("hello youandmeandirc")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		case "export":
+			os.Exit(exportHistory(os.Args[2:]))
+		case "import":
+			os.Exit(importHistory(os.Args[2:]))
+		}
+	}
+	flag.Parse()
+	os.Exit(run())
+}
+
+// run runs the bot until it's told to stop, and returns the exit code.
+func run() int {
+	mainLog.Info("hello youandmeandirc")
 
 	bot, err := irclib.NewBot()
 	if err != nil {
-		log.Fatalln("Unable to create bot:", err)
+		mainLog.Error("Unable to create bot", "err", err)
+		return exitConfig
 	}
 
-	addr := net.JoinHostPort(*host, *port)
-	timeout, _ := time.ParseDuration("1m")
+	if *config != "" {
+		if err := bot.LoadConfig(*config); err != nil {
+			mainLog.Error("Unable to load config", "err", err)
+			return exitConfig
+		}
+		go reloadOnHangup(bot)
+	} else if err := bot.Configure(flagConfig()); err != nil {
+		mainLog.Error("Bad flags", "err", err)
+		return exitConfig
+	}
 
-	// TODO(wonderzombie): Fix this so that IrcConn takes a closure, or something
-	// which can generate net.Conn items for it.
-	n, _ := net.DialTimeout("tcp", addr, timeout)
-	// defer conn.Close()
-	c, err := irc.Connect(n, *nick, "...", *username, *pass)
-	if err != nil {
-		log.Fatalln("Unable to connect:", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := bot.Start(ctx); err != nil {
+		mainLog.Error("Shut down with errors", "err", err)
+		return exitShutdown
 	}
-	bot.Start(c)
+	mainLog.Info("Bye!")
+	return exitOK
 }
@@ -1,3 +1,91 @@
 package main
 
-import ()
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetworkSpec(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    networkSpec
+		wantErr bool
+	}{
+		{
+			in:   "home=home.zole.org:6667/#testbot",
+			want: networkSpec{"home", "home.zole.org:6667", []string{"#testbot"}},
+		},
+		{
+			in:   "libera=irc.libera.chat:6697/#go-nuts, #testbot",
+			want: networkSpec{"libera", "irc.libera.chat:6697", []string{"#go-nuts", "#testbot"}},
+		},
+		{
+			in:   "quiet=localhost:6667",
+			want: networkSpec{"quiet", "localhost:6667", nil},
+		},
+		{in: "home.zole.org:6667/#testbot", wantErr: true},
+		{in: "home=home.zole.org/#testbot", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseNetworkSpec(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseNetworkSpec(%q) => %+v; want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseNetworkSpec(%q) => %+v, %v; want %+v", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestPrintDiff(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		want     string
+		wantSame bool
+	}{
+		{
+			a:        []string{"one", "two"},
+			b:        []string{"one", "two"},
+			want:     "  one\n  two\n",
+			wantSame: true,
+		},
+		{
+			a:    []string{"one", "two", "three"},
+			b:    []string{"one", "2", "three", "four"},
+			want: "  one\n- two\n+ 2\n  three\n+ four\n",
+		},
+		{
+			a:    []string{"one"},
+			want: "- one\n",
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		same := printDiff(&buf, test.a, test.b)
+		if got := buf.String(); got != test.want || same != test.wantSame {
+			t.Errorf("printDiff(%q, %q) => %q, %v; want %q, %v", test.a, test.b, got, same, test.want, test.wantSame)
+		}
+	}
+}
+
+func TestParseLogLevels(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"debug", map[string]string{"default": "debug"}},
+		{"warn,conn=debug, score=info", map[string]string{"default": "warn", "conn": "debug", "score": "info"}},
+	}
+
+	for _, test := range tests {
+		if got := parseLogLevels(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseLogLevels(%q) => %v; want %v", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	irclib "github.com/wonderzombie/youandmeandirc"
+	"github.com/wonderzombie/youandmeandirc/irc"
+)
+
+// replay runs gobot replay: it feeds a transcript written by a network's "record" setting back through the bot, and
+// prints a diff of what the bot said then against what it says now.
+//
+//	gobot replay [-config gobot.json] [-network name] transcript.log
+func replay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	config := fs.String("config", "", "JSON config file, for per-channel settings. State isn't loaded.")
+	network := fs.String("network", "", "Network the transcript was recorded on. Defaults to the first in the config.")
+	if err := fs.Parse(args); err != nil {
+		return exitConfig
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gobot replay [-config file] [-network name] transcript")
+		return exitConfig
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		mainLog.Error("Unable to open transcript", "err", err)
+		return exitConfig
+	}
+	entries, err := irc.ReadTranscript(f)
+	f.Close()
+	if err != nil {
+		mainLog.Error("Unable to read transcript", "path", fs.Arg(0), "err", err)
+		return exitConfig
+	}
+
+	bot, err := irclib.NewBot()
+	if err != nil {
+		mainLog.Error("Unable to create bot", "err", err)
+		return exitConfig
+	}
+	if *config != "" {
+		cfg, err := irclib.ReadConfig(*config)
+		if err != nil {
+			mainLog.Error("Unable to load config", "err", err)
+			return exitConfig
+		}
+		// Replays shouldn't see, or touch, the live bot's scores and such.
+		cfg.StateDir = ""
+		if err := bot.Configure(cfg); err != nil {
+			mainLog.Error("Bad config", "err", err)
+			return exitConfig
+		}
+		if *network == "" {
+			*network = cfg.Networks[0].Name
+		}
+	}
+	if *network == "" {
+		*network = "replay"
+	}
+
+	recorded, replayed := bot.Replay(*network, entries)
+	if !printDiff(os.Stdout, recorded, replayed) {
+		return exitDiffers
+	}
+	fmt.Println("No differences.")
+	return exitOK
+}
+
+// printDiff writes a line diff of a against b to w, with - for lines only in a and + for lines only in b, and reports
+// whether they were the same.
+func printDiff(w io.Writer, a, b []string) (same bool) {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	same = true
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintln(w, " ", a[i])
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintln(w, "-", a[i])
+			i, same = i+1, false
+		default:
+			fmt.Fprintln(w, "+", b[j])
+			j, same = j+1, false
+		}
+	}
+	return same
+}
@@ -0,0 +1,79 @@
+package youandmeandirc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+const (
+	// defaultHandlerTimeout is how long a module gets to handle a message, unless the config says otherwise.
+	defaultHandlerTimeout = 10 * time.Second
+	// maxAsyncHandlers is how many messages an async module can be handling at once. Past that, messages are
+	// dropped rather than piling up behind a module that's stuck.
+	maxAsyncHandlers = 4
+)
+
+// handlerContext returns the context for a handler: it's cancelled when the bot stops, or when the handler's had
+// handlerTimeout.
+func (bot *IrcBot) handlerContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(bot.handlerCtx, bot.handlerTimeout)
+}
+
+// handle passes msg to l on the dispatch loop, and reports whether l trapped it.
+func (bot *IrcBot) handle(l moduleListener, msg irc.Message) (trap bool) {
+	ctx, cancel := bot.handlerContext()
+	defer cancel()
+	fired, trap := bot.run(ctx, l, msg)
+	if fired {
+		bot.metrics.fired.Inc(l.Name)
+	}
+	if trap {
+		bot.metrics.trapped.Inc(l.Name)
+	}
+	return trap
+}
+
+// handleAsync passes msg to l on a goroutine of its own, unless l is already handling as many messages as it's
+// allowed to, in which case msg is dropped. Async listeners can't trap messages.
+func (bot *IrcBot) handleAsync(l moduleListener, msg irc.Message) {
+	slots := bot.asyncSlots[l.Name]
+	select {
+	case slots <- struct{}{}:
+	default:
+		logging.Module(l.Name).Warn("Too busy, dropping message", "network", msg.Network, "channel", msg.Channel,
+			"line", msg.Raw, "running", cap(slots))
+		bot.metrics.dropped.Inc(l.Name)
+		return
+	}
+
+	ctx, cancel := bot.handlerContext()
+	bot.async.Add(1)
+	go func() {
+		defer bot.async.Done()
+		defer func() { <-slots }()
+		defer cancel()
+		if fired, _ := bot.run(ctx, l, msg); fired {
+			bot.metrics.fired.Inc(l.Name)
+		}
+	}()
+}
+
+// run fires l, keeping track of how long it took and whether it went past its deadline.
+func (bot *IrcBot) run(ctx context.Context, l moduleListener, msg irc.Message) (fired, trap bool) {
+	// This is about how long the code takes, so it's always wall time, whatever bot.clock says.
+	start := time.Now()
+	fired, trap = bot.fire(ctx, l, msg)
+	took := time.Since(start)
+	bot.metrics.latency.Observe(took.Seconds(), l.Name)
+	bot.metrics.handled.Inc(l.Name)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logging.Module(l.Name).Warn("Handler overran its deadline", "network", msg.Network, "channel", msg.Channel,
+			"line", msg.Raw, "took", took)
+		bot.metrics.overran.Inc(l.Name)
+	}
+	return fired, trap
+}
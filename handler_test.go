@@ -0,0 +1,132 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+)
+
+func TestRepliesAfterTheDeadlineAreDropped(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	bot.handlerTimeout = time.Millisecond
+
+	bot.Register(shared("slow", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			<-ctx.Done()
+			bot.Reply(ctx, msg, "sorry, was that to me?")
+			return true, false
+		}
+	}))
+	bot.Register(shared("quick", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			bot.Reply(ctx, msg, "hi yourself")
+			return true, false
+		}
+	}))
+
+	bot.runListeners(privmsg("alice", "hi"))
+	flush(n)
+	if got := client.Said("#test"); len(got) != 1 || got[0] != "hi yourself" {
+		t.Errorf("said %q; want only the quick module's reply", got)
+	}
+	if got := bot.metrics.overran.Value("slow"); got != 1 {
+		t.Errorf("overran{slow} => %v; want 1", got)
+	}
+}
+
+func TestAsyncModules(t *testing.T) {
+	bot, n, client := newTestBot(t)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	bot.Register(async(shared("slow", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			started <- struct{}{}
+			<-release
+			bot.Reply(ctx, msg, "done thinking about "+msg.Text)
+			return true, true
+		}
+	})))
+	after := 0
+	bot.Register(shared("after", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			after++
+			return true, false
+		}
+	}))
+
+	extra := 2
+	for i := 0; i < maxAsyncHandlers+extra; i++ {
+		bot.runListeners(privmsg("alice", "hi"))
+	}
+	for i := 0; i < maxAsyncHandlers; i++ {
+		<-started
+	}
+	if after != maxAsyncHandlers+extra {
+		t.Errorf("the module after slow saw %d messages; want all %d, since slow can't hold them up",
+			after, maxAsyncHandlers+extra)
+	}
+	if got := bot.metrics.dropped.Value("slow"); got != float64(extra) {
+		t.Errorf("dropped{slow} => %v; want %v", got, extra)
+	}
+
+	close(release)
+	bot.async.Wait()
+	flush(n)
+	if got := client.Said("#test"); len(got) != maxAsyncHandlers {
+		t.Errorf("said %q; want %d replies", got, maxAsyncHandlers)
+	}
+	if got := bot.metrics.fired.Value("slow"); got != maxAsyncHandlers {
+		t.Errorf("fired{slow} => %v; want %v", got, maxAsyncHandlers)
+	}
+}
+
+func TestStoppingCancelsHandlers(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	bot.handlerCtx = ctx
+
+	release := make(chan struct{})
+	bot.Register(async(shared("slow", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			<-release
+			bot.Reply(ctx, msg, "still here?")
+			return true, false
+		}
+	})))
+
+	bot.runListeners(privmsg("alice", "hi"))
+	cancel()
+	close(release)
+	bot.async.Wait()
+	flush(n)
+	if got := client.Said("#test"); len(got) != 0 {
+		t.Errorf("said %q after stopping; want nothing", got)
+	}
+}
+
+func TestAsyncModulesReadSettings(t *testing.T) {
+	bot, n, client := newTestBot(t)
+
+	bot.Register(async(shared("slow", func() Listener {
+		return func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+			bot.Reply(ctx, msg, "done thinking")
+			return true, true
+		}
+	})))
+
+	// Admin commands change settings on the dispatch loop while async modules read them; run with -race.
+	for i := 0; i < maxAsyncHandlers; i++ {
+		bot.runListeners(privmsg("alice", "hi"))
+		bot.settings.Set("test", "#test", "sleep-time", fmt.Sprintf("%dm", i+1))
+		bot.settings.Describe("test", "#test")
+	}
+	bot.async.Wait()
+	flush(n)
+	if got := client.Said("#test"); len(got) != maxAsyncHandlers {
+		t.Errorf("said %q; want %d replies", got, maxAsyncHandlers)
+	}
+}
@@ -3,11 +3,14 @@ package irc
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"net"
 	"strings"
+
+	"github.com/wonderzombie/youandmeandirc/logging"
 )
 
+var connLog = logging.Subsystem("conn")
+
 // Conn represents a connection to an IRC server.
 type Conn struct {
 	username string
@@ -15,8 +18,9 @@ type Conn struct {
 	nick     string
 	realname string
 
-	conn   net.Conn
-	reader *bufio.Reader
+	conn     net.Conn
+	reader   *bufio.Reader
+	recorder *Recorder
 
 	host string
 	port string
@@ -24,7 +28,8 @@ type Conn struct {
 
 // send transmits a command to the currently connected server.
 func (irc Conn) send(s string) error {
-	log.Println("=>", s)
+	connLog.Debug("Sending", "line", redact(s))
+	irc.recorder.record(Outbound, s)
 	_, err := fmt.Fprintln(irc.conn, s)
 	return err
 }
@@ -32,8 +37,9 @@ func (irc Conn) send(s string) error {
 // sendfln is a thin wrapper around *printf.
 func (irc Conn) sendfln(format string, a ...interface{}) error {
 	msg := fmt.Sprintf(format+"\n", a...)
-	log.Printf("=> %s", msg)
-	_, err := fmt.Print(irc.conn, msg)
+	connLog.Debug("Sending", "line", redact(strings.TrimRight(msg, "\r\n")))
+	irc.recorder.record(Outbound, msg)
+	_, err := fmt.Fprint(irc.conn, msg)
 	return err
 }
 
@@ -48,7 +54,7 @@ func (irc Conn) register() error {
 
 	for _, m := range messages {
 		if err := irc.send(m); err != nil {
-			log.Println("Error:", err)
+			connLog.Error("Unable to register", "err", err)
 			return err
 		}
 	}
@@ -77,11 +83,22 @@ func (irc Conn) Say(channel, chat string) error {
 	return irc.sendfln("PRIVMSG %v :%v", channel, chat)
 }
 
+// Sends a notice to a channel or nick. Bots aren't supposed to reply to notices, and clients tend to show them apart
+// from the conversation.
+func (irc Conn) Notice(target, text string) error {
+	return irc.sendfln("NOTICE %v :%v", target, text)
+}
+
 // Joins a given channel.
 func (irc Conn) Join(channel string) error {
 	return irc.sendfln("JOIN %v", channel)
 }
 
+// Leaves a given channel.
+func (irc Conn) Part(channel, message string) error {
+	return irc.sendfln("PART %v :%v", channel, message)
+}
+
 func (irc Conn) Names(channel string) error {
 	return irc.sendfln("NAMES %v", channel)
 }
@@ -94,25 +111,37 @@ func (irc Conn) SetNick(nick string) error {
 	return nil
 }
 
-// Reads a single message from the server's output.
+// Reads a single message from the server's output. Lines that can't be parsed are logged and skipped.
 func (irc Conn) Read() (*Message, error) {
-	s, err := irc.reader.ReadString('\n')
-	log.Println("<=", strings.TrimRight(s, "\r\n"))
-	if err != nil {
-		log.Println("Error reading from server:", err)
-		return nil, err
+	var m *Message
+	for m == nil {
+		s, err := irc.reader.ReadString('\n')
+		if err != nil {
+			connLog.Debug("Error reading from server", "err", err)
+			return nil, err
+		}
+		connLog.Debug("Received", "line", strings.TrimRight(s, "\r\n"))
+		irc.recorder.record(Inbound, s)
+
+		if m, err = ParseMessage(s); err != nil {
+			parserLog.Warn("Skipping malformed line", "line", strings.TrimRight(s, "\r\n"), "err", err)
+		}
 	}
 
-	m := NewMessage(s)
 	if m.Command == Ping {
 		if err := irc.Pong(m.Source); err != nil {
-			log.Printf("Error trying to pong: %v", err)
+			connLog.Warn("Unable to pong", "err", err)
 		}
 	}
 
 	return m, nil
 }
 
+// Ping asks the server to echo token back to us in a PONG.
+func (irc Conn) Ping(token string) error {
+	return irc.sendfln("PING :%v", token)
+}
+
 func (irc Conn) Pong(daemon string) error {
 	// FIXME: shouldn't this be handled automatically?
 	// Specifically, this is protocol-level stuff. We could (should?) hide this from the user.
@@ -123,17 +152,34 @@ func (irc Conn) Nick() string {
 	return irc.nick
 }
 
+// Quit tells the server we're leaving. The server closes the connection once it has seen this.
+func (irc Conn) Quit(message string) error {
+	return irc.sendfln("QUIT :%v", message)
+}
+
 // Should probably DTRT IRC protocol-wise, like sending a quit message.
 func (irc Conn) Disconnect() error {
 	irc.sendfln("QUIT :why do you hate me")
 	return irc.conn.Close()
 }
 
+// Close drops the underlying connection without saying goodbye. Any pending Read returns an error.
+func (irc Conn) Close() error {
+	return irc.conn.Close()
+}
+
 // Connect initiates the IRC protocol with the given credentails.
 func Connect(n net.Conn, nick, realname, username, pass string) (*Conn, error) {
+	return ConnectWithRecorder(n, nil, nick, realname, username, pass)
+}
+
+// ConnectWithRecorder is like Connect, but everything sent and received, starting with registration, is written to
+// rec.
+func ConnectWithRecorder(n net.Conn, rec *Recorder, nick, realname, username, pass string) (*Conn, error) {
 	c := &Conn{
 		conn:     n,
 		reader:   bufio.NewReader(n),
+		recorder: rec,
 		nick:     nick,
 		realname: realname,
 		username: username,
@@ -1,3 +1,62 @@
 package irc
 
-import ()
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestConnect(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		r := bufio.NewReader(server)
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- s
+		}
+	}()
+
+	c, err := Connect(client, "gobot", "Go Bot", "bot", "sekrit")
+	if err != nil {
+		t.Fatalf("Connect() => %v", err)
+	}
+	c.Say("#testbot", "hello")
+	c.Close()
+
+	want := []string{
+		"PASS sekrit\n",
+		"NICK gobot\n",
+		"USER bot * * :Go Bot\n",
+		"PRIVMSG #testbot :hello\n",
+	}
+	for _, w := range want {
+		if got := <-lines; got != w {
+			t.Errorf("server got %q; want %q", got, w)
+		}
+	}
+}
+
+func TestReadSkipsMalformedLines(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		fmt.Fprint(server, "\r\n:irctest\r\n:alice!alice@irctest PRIVMSG\r\n:alice!alice@irctest PRIVMSG #testbot :hi\r\n")
+	}()
+
+	c := &Conn{conn: client, reader: bufio.NewReader(client)}
+	m, err := c.Read()
+	if err != nil {
+		t.Fatalf("Read() => %v", err)
+	}
+	if m.Command != Privmsg || m.Text != "hi" {
+		t.Errorf("Read() => %+v; want alice's hi", m)
+	}
+}
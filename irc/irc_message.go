@@ -1,6 +1,13 @@
 package irc
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var parserLog = logging.Subsystem("parser")
 
 type Command int
 
@@ -13,6 +20,9 @@ const (
 	Notice
 	Num // numeric commands
 	Quit
+	Pong
+	Nick
+	Kick
 )
 
 // Lookup table for commands against IDs.
@@ -24,6 +34,10 @@ var CommandIndex = map[string]Command{
 	"PART":    Part, // recognized but ignored
 	"JOIN":    Join,
 	"NOTICE":  Notice, // recognized but ignored
+	"PONG":    Pong,
+	"QUIT":    Quit,
+	"NICK":    Nick,
+	"KICK":    Kick,
 }
 
 func (c Command) String() string {
@@ -46,6 +60,7 @@ type Message struct {
 	Args    []string // Misc params.
 	User    string
 	Nick    string
+	Network string // Name of the network the message arrived on, if any.
 }
 
 // splitMsg splits a string on a colon into the parts before and after.
@@ -91,34 +106,59 @@ func whoIs(prefix string) (string, string) {
 	}
 
 	nick := prefix[0:bangPos]
-	user := prefix[tildePos+1 : atPos]
+	user := ""
+	if tildePos < atPos {
+		user = prefix[tildePos+1 : atPos]
+	}
 
 	return user, nick
 }
 
+// NewMessage parses a line from the server. If the line is malformed, the message has nothing but Raw; use
+// ParseMessage to find out why.
 func NewMessage(msg string) *Message {
-	m := &Message{}
+	m, err := ParseMessage(msg)
+	if err != nil {
+		return &Message{Raw: msg}
+	}
+	return m
+}
+
+// ParseMessage parses a line from the server, or returns an error if it's too mangled to make sense of.
+func ParseMessage(msg string) (*Message, error) {
+	m := &Message{Raw: strings.TrimRight(msg, "\r\n")}
 	// Trim trailing nonprinting character.
 	msg = strings.Trim(strings.TrimSpace(msg), "\x01")
 	command, content := splitMsg(msg)
 	commandTokens := strings.Fields(command)
+	if len(commandTokens) == 0 {
+		return nil, fmt.Errorf("empty line")
+	}
 
 	// Ping is easy to rule out since it's two tokens.
 	tok := commandTokens[0]
 	if cmd, ok := CommandIndex[tok]; ok && cmd == Ping {
 		m.Source = content
 		m.Command = cmd
-		return m
+		return m, nil
+	}
+	if len(commandTokens) < 2 {
+		return nil, fmt.Errorf("no command in %q", msg)
 	}
 
 	source, cmd := commandTokens[0], commandTokens[1]
-	m.Nick, m.User = whoIs(source)
-	m.Source = m.User
+	// whoIs returns the user first. These used to be the wrong way around, so Nick held the user name and Source
+	// with it; anything which compared them with nicks only worked when the two happened to match.
+	m.User, m.Nick = whoIs(source)
+	m.Source = m.Nick
 
 	id, ok := CommandIndex[cmd]
 	// A miss means this is probably a numeric code.
 	// https://tools.ietf.org/html/rfc2812#section-5.1
 	if !ok {
+		if strings.Trim(cmd, "0123456789") != "" {
+			parserLog.Debug("Unrecognized command", "command", cmd, "line", msg)
+		}
 		m.Command = Num
 		m.Code = cmd
 		// Sometimes there's extra stuff, so don't drop it.
@@ -128,22 +168,58 @@ func NewMessage(msg string) *Message {
 		if content != "" {
 			m.Text = content
 		}
-		return m
+		return m, nil
 	}
 
 	// This is a user-relevant event.
 	m.Command = id
 	switch id {
+	case Privmsg, Mode, Notice, Part:
+		if len(commandTokens) < 3 {
+			return nil, fmt.Errorf("%v with no target in %q", cmd, msg)
+		}
+	case Kick:
+		if len(commandTokens) < 4 {
+			return nil, fmt.Errorf("KICK with no channel or nick in %q", msg)
+		}
+	case Nick:
+		if len(commandTokens) < 3 && content == "" {
+			return nil, fmt.Errorf("NICK with no new nick in %q", msg)
+		}
+	}
+	switch id {
 	case Join:
+		// Some servers put the channel after a colon, and some don't.
 		m.Channel = content
+		if len(commandTokens) > 2 {
+			m.Channel = commandTokens[2]
+		}
 	case Privmsg, Mode, Notice:
 		m.Channel = commandTokens[2]
 		m.Text = content
 	case Part:
+		// Text is the reason for leaving, if any.
 		m.Channel = commandTokens[2]
+		m.Text = content
+	case Quit:
+		m.Text = content
+	case Nick:
+		// Nick is the old nick, and Text the new one.
+		m.Text = content
+		if len(commandTokens) > 2 {
+			m.Text = commandTokens[2]
+		}
+	case Kick:
+		// Args holds who was kicked, Nick who kicked them, and Text why.
+		m.Channel = commandTokens[2]
+		m.Args = commandTokens[3:4]
+		m.Text = content
+	case Pong:
+		// The server echoes back whatever we put in our PING.
+		m.Text = content
 	}
 
-	return m
+	return m, nil
 }
 
 func (m *Message) MatchesAny(cmds []Command) bool {
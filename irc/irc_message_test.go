@@ -11,6 +11,8 @@ type MessageTest struct {
 	origin  string
 	channel string
 	text    string
+	nick    string
+	user    string
 }
 
 var tests = []MessageTest{
@@ -26,6 +28,8 @@ var tests = []MessageTest{
 		origin:  "nick",
 		channel: "#channel",
 		text:    "chat chat chat",
+		nick:    "nick",
+		user:    "username",
 	},
 	{
 		in:      ":server PING",
@@ -39,12 +43,66 @@ var tests = []MessageTest{
 		channel: "#channel",
 		text:    "ACTION emote",
 	},
+	{
+		in:      ":server PONG server :1234",
+		command: Pong,
+		origin:  "server",
+		text:    "1234",
+	},
 	{
 		in:      ":trapro!~trahari@75-145-17-54-Washington.hfc.comcastbusiness.net PRIVMSG gobot :HELLO",
 		command: Privmsg,
 		origin:  "trapro",
 		channel: "gobot",
 		text:    "HELLO",
+		nick:    "trapro",
+		user:    "trahari",
+	},
+	{
+		in:      ":nick!~username@host JOIN :#channel",
+		command: Join,
+		origin:  "nick",
+		channel: "#channel",
+		nick:    "nick",
+		user:    "username",
+	},
+	{
+		in:      ":nick!~username@host JOIN #channel",
+		command: Join,
+		origin:  "nick",
+		channel: "#channel",
+	},
+	{
+		in:      ":nick!~username@host PART #channel :gone fishing",
+		command: Part,
+		origin:  "nick",
+		channel: "#channel",
+		text:    "gone fishing",
+	},
+	{
+		in:      ":nick!~username@host QUIT :Ping timeout: 240 seconds",
+		command: Quit,
+		origin:  "nick",
+		text:    "Ping timeout: 240 seconds",
+	},
+	{
+		in:      ":nick!~username@host NICK :nick_",
+		command: Nick,
+		origin:  "nick",
+		text:    "nick_",
+	},
+	{
+		in:      ":nick!~username@host NICK nick|away",
+		command: Nick,
+		origin:  "nick",
+		text:    "nick|away",
+	},
+	{
+		in:      ":op!~username@host KICK #channel nick :no spamming",
+		command: Kick,
+		origin:  "op",
+		channel: "#channel",
+		text:    "no spamming",
 	},
 }
 
@@ -76,6 +134,14 @@ func verify(tt *MessageTest, mm *Message) []string {
 		errors = append(errors, fmt.Sprintf("text: got %q, want %q", mm.Text, tt.text))
 	}
 
+	if tt.nick != "" && tt.nick != mm.Nick {
+		errors = append(errors, fmt.Sprintf("nick: got %q, want %q", mm.Nick, tt.nick))
+	}
+
+	if tt.user != "" && tt.user != mm.User {
+		errors = append(errors, fmt.Sprintf("user: got %q, want %q", mm.User, tt.user))
+	}
+
 	return errors
 }
 
@@ -130,3 +196,24 @@ func TestSplitMsg(t *testing.T) {
 		}
 	}
 }
+
+func TestParseMalformed(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"\r\n",
+		":",
+		":server",
+		":nick!~user@host PRIVMSG",
+		":nick!~user@host PART",
+		":nick!~user@host MODE :+i",
+		":op!~user@host KICK #channel",
+		":nick!~user@host NICK",
+	} {
+		if m, err := ParseMessage(in); err == nil {
+			t.Errorf("ParseMessage(%q) => %+v; want error", in, m)
+		}
+		if m := NewMessage(in); m.Command != 0 {
+			t.Errorf("NewMessage(%q) => %+v; want nothing but Raw", in, m)
+		}
+	}
+}
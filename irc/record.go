@@ -0,0 +1,97 @@
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directions of traffic in a transcript, from the client's point of view.
+const (
+	Inbound  = "<="
+	Outbound = "=>"
+)
+
+// Recorder writes a transcript of a connection's traffic, one line per message, like so:
+//
+//	2026-10-19T13:41:09.170169193Z => PRIVMSG #testbot :hello
+//	2026-10-19T13:41:09.3012Z <= :alice!~alice@host PRIVMSG #testbot :hi gobot
+//
+// Passwords are left out.
+type Recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, now: time.Now}
+}
+
+// record writes a single line of traffic. A nil Recorder records nothing.
+func (r *Recorder) record(direction, line string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.w, "%v %v %v\n", r.now().UTC().Format(time.RFC3339Nano), direction, redact(strings.TrimRight(line, "\r\n")))
+}
+
+// saslMechanisms are the AUTHENTICATE arguments which aren't credentials.
+var saslMechanisms = map[string]bool{"PLAIN": true, "EXTERNAL": true, "SCRAM-SHA-256": true, "+": true, "*": true}
+
+// redact blanks out passwords in a line we're sending, whether it's for the server, SASL or NickServ. It's used for
+// anything that gets written down, so logs and transcripts can be shared.
+func redact(line string) string {
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 0:
+		return line
+	case fields[0] == "PASS":
+		return "PASS ****"
+	case fields[0] == "AUTHENTICATE" && len(fields) > 1 && !saslMechanisms[fields[1]]:
+		return "AUTHENTICATE ****"
+	case fields[0] == "PRIVMSG" && len(fields) > 2 && strings.EqualFold(fields[1], "NickServ"):
+		cmd := strings.ToUpper(strings.TrimPrefix(fields[2], ":"))
+		if cmd == "IDENTIFY" || cmd == "REGISTER" || cmd == "GHOST" || cmd == "RECOVER" {
+			return fmt.Sprintf("PRIVMSG %v :%v ****", fields[1], cmd)
+		}
+	}
+	return line
+}
+
+// Entry is a single line from a transcript.
+type Entry struct {
+	Time      time.Time
+	Direction string // Inbound or Outbound.
+	Line      string
+}
+
+// ReadTranscript reads a transcript written by a Recorder.
+func ReadTranscript(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		if s.Text() == "" {
+			continue
+		}
+		parts := strings.SplitN(s.Text(), " ", 3)
+		if len(parts) < 2 || parts[1] != Inbound && parts[1] != Outbound {
+			return nil, fmt.Errorf("line %d: not a transcript line: %q", n, s.Text())
+		}
+		t, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		e := Entry{Time: t, Direction: parts[1]}
+		if len(parts) == 3 {
+			e.Line = parts[2]
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
@@ -0,0 +1,61 @@
+package irc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecorderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	now := time.Date(2026, 10, 19, 13, 41, 9, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	r.record(Outbound, "PASS sekrit\n")
+	r.record(Outbound, "PRIVMSG #testbot :hello\n")
+	r.record(Inbound, ":alice!~alice@host PRIVMSG #testbot :hi gobot\r\n")
+
+	got, err := ReadTranscript(&buf)
+	if err != nil {
+		t.Fatalf("ReadTranscript() => %v", err)
+	}
+	want := []Entry{
+		{now, Outbound, "PASS ****"},
+		{now, Outbound, "PRIVMSG #testbot :hello"},
+		{now, Inbound, ":alice!~alice@host PRIVMSG #testbot :hi gobot"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadTranscript() => %+v; want %+v", got, want)
+	}
+}
+
+func TestReadTranscriptRejectsJunk(t *testing.T) {
+	if _, err := ReadTranscript(bytes.NewBufferString("this is not a transcript\n")); err == nil {
+		t.Errorf("ReadTranscript(junk) => nil; want error")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"PASS sekrit", "PASS ****"},
+		{"PASS ", "PASS ****"},
+		{"AUTHENTICATE PLAIN", "AUTHENTICATE PLAIN"},
+		{"AUTHENTICATE +", "AUTHENTICATE +"},
+		{"AUTHENTICATE Z29ib3QAZ29ib3QAc2Vrcml0", "AUTHENTICATE ****"},
+		{"PRIVMSG NickServ :IDENTIFY gobot sekrit", "PRIVMSG NickServ :IDENTIFY ****"},
+		{"PRIVMSG nickserv :identify sekrit", "PRIVMSG nickserv :IDENTIFY ****"},
+		{"PRIVMSG NickServ :INFO gobot", "PRIVMSG NickServ :INFO gobot"},
+		{"PRIVMSG #testbot :PASS the salt", "PRIVMSG #testbot :PASS the salt"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := redact(test.in); got != test.want {
+			t.Errorf("redact(%q) => %q; want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package irctest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Client is a fake connection which records what's sent to it, as the lines that would have gone to the server. It
+// satisfies the bot's Client interface.
+type Client struct {
+	mu     sync.Mutex // guards the fields below
+	nick   string
+	lines  []string
+	closed bool
+}
+
+// NewClient returns a fake connection registered as nick.
+func NewClient(nick string) *Client {
+	return &Client{nick: nick}
+}
+
+func (c *Client) record(format string, a ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return fmt.Errorf("irctest: client is closed")
+	}
+	c.lines = append(c.lines, fmt.Sprintf(format, a...))
+	return nil
+}
+
+// Lines returns everything sent so far, oldest first.
+func (c *Client) Lines() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.lines...)
+}
+
+// Said returns the text of everything said to target so far, oldest first.
+func (c *Client) Said(target string) []string {
+	prefix := fmt.Sprintf("PRIVMSG %v :", target)
+	var said []string
+	for _, line := range c.Lines() {
+		if strings.HasPrefix(line, prefix) {
+			said = append(said, strings.TrimPrefix(line, prefix))
+		}
+	}
+	return said
+}
+
+// Noticed returns the text of every notice sent to target so far, oldest first.
+func (c *Client) Noticed(target string) []string {
+	prefix := fmt.Sprintf("NOTICE %v :", target)
+	var noticed []string
+	for _, line := range c.Lines() {
+		if strings.HasPrefix(line, prefix) {
+			noticed = append(noticed, strings.TrimPrefix(line, prefix))
+		}
+	}
+	return noticed
+}
+
+// Reset forgets everything sent so far.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = nil
+}
+
+// Closed reports whether Close or Quit has been called.
+func (c *Client) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *Client) Nick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+// SetNick changes the nick the client reports, as if the server had accepted a NICK.
+func (c *Client) SetNick(nick string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nick = nick
+}
+
+func (c *Client) Say(channel, chat string) error {
+	return c.record("PRIVMSG %v :%v", channel, chat)
+}
+
+func (c *Client) Notice(target, text string) error {
+	return c.record("NOTICE %v :%v", target, text)
+}
+
+func (c *Client) Join(channel string) error {
+	return c.record("JOIN %v", channel)
+}
+
+func (c *Client) Part(channel, message string) error {
+	return c.record("PART %v :%v", channel, message)
+}
+
+func (c *Client) Names(channel string) error {
+	return c.record("NAMES %v", channel)
+}
+
+func (c *Client) Ping(token string) error {
+	return c.record("PING :%v", token)
+}
+
+func (c *Client) Quit(message string) error {
+	err := c.record("QUIT :%v", message)
+	c.Close()
+	return err
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,76 @@
+package irctest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock for tests. Time only moves when Advance or Sleep is called. It satisfies the bot's Clock
+// interface.
+type Clock struct {
+	mu      sync.Mutex // guards the fields below
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewClock returns a fake clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep moves the clock forward by d instead of waiting, so that things like pretend typing don't slow tests down.
+func (c *Clock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// After returns a channel which gets the time once the clock has been moved forward by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{c.now.Add(d), ch})
+	return ch
+}
+
+// Waiters is how many After channels haven't fired yet. Tests can use it to know a goroutine is waiting on the clock.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Advance moves the clock forward by d, firing any After channels which are due.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+
+	var pending []waiter
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
@@ -0,0 +1,265 @@
+// Package irctest provides a fake IRC server for testing bots end to end, without a network.
+package irctest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+)
+
+// DefaultTimeout is how long Expect waits for a matching line.
+const DefaultTimeout = 5 * time.Second
+
+// Server is a fake IRC server which talks to one client at a time. It handles registration, JOIN, PART, NAMES and
+// PING on its own. Tests inject lines from other users with Say, Action, Join and Send, and check what the client
+// sends back with Expect and ExpectNone.
+type Server struct {
+	t       testing.TB
+	Timeout time.Duration
+
+	// received gets every line the client sends.
+	received chan string
+
+	mu      sync.Mutex // guards the fields below
+	conn    net.Conn
+	nick    string
+	members map[string]map[string]bool // by channel
+	dials   int
+}
+
+// NewServer returns a server which reports problems to t.
+func NewServer(t testing.TB) *Server {
+	return &Server{
+		t:        t,
+		Timeout:  DefaultTimeout,
+		received: make(chan string, 1024),
+		members:  make(map[string]map[string]bool),
+	}
+}
+
+// Dial returns the client's end of a new connection to the server, hanging up on any previous client.
+func (s *Server) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = server
+	s.dials++
+	s.mu.Unlock()
+
+	go s.serve(server)
+	return client, nil
+}
+
+// Dials is how many times the client has connected.
+func (s *Server) Dials() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+// Connect returns a function which connects to the server and registers as nick. It can be used as the bot's
+// ConnectFn.
+func (s *Server) Connect(nick string) func() (*irc.Conn, error) {
+	return func() (*irc.Conn, error) {
+		c, err := s.Dial()
+		if err != nil {
+			return nil, err
+		}
+		return irc.Connect(c, nick, "irctest", nick, "")
+	}
+}
+
+// Hangup closes the connection to the client, as if the server had gone away.
+func (s *Server) Hangup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// serve reads from the client until it hangs up.
+func (s *Server) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		s.handle(conn, line)
+		s.received <- line
+	}
+}
+
+// handle takes care of the protocol-level business a real server would.
+func (s *Server) handle(conn net.Conn, line string) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "NICK":
+		s.mu.Lock()
+		s.nick = fields[1]
+		s.mu.Unlock()
+
+	case "USER":
+		nick := s.Nick()
+		s.write(conn, fmt.Sprintf(":irctest 001 %v :Welcome to irctest, %v", nick, nick))
+		s.write(conn, fmt.Sprintf(":%v MODE %v :+i", nick, nick))
+
+	case "PING":
+		s.write(conn, fmt.Sprintf(":irctest PONG irctest %v", strings.Join(fields[1:], " ")))
+
+	case "JOIN":
+		nick := s.Nick()
+		for _, channel := range strings.Split(fields[1], ",") {
+			s.addMember(channel, nick)
+			s.write(conn, fmt.Sprintf(":%v!%v@irctest JOIN :%v", nick, nick, channel))
+			s.writeNames(conn, channel)
+		}
+
+	case "NAMES":
+		s.writeNames(conn, fields[1])
+
+	case "PART":
+		nick := s.Nick()
+		s.mu.Lock()
+		delete(s.members[strings.ToLower(fields[1])], nick)
+		s.mu.Unlock()
+		s.write(conn, fmt.Sprintf(":%v!%v@irctest PART %v", nick, nick, fields[1]))
+
+	case "QUIT":
+		conn.Close()
+	}
+}
+
+func (s *Server) writeNames(conn net.Conn, channel string) {
+	nick := s.Nick()
+	s.write(conn, fmt.Sprintf(":irctest 353 %v = %v :%v", nick, channel, strings.Join(s.Members(channel), " ")))
+	s.write(conn, fmt.Sprintf(":irctest 366 %v %v :End of /NAMES list.", nick, channel))
+}
+
+func (s *Server) write(conn net.Conn, line string) {
+	// If the client has gone, so be it.
+	fmt.Fprintf(conn, "%v\r\n", line)
+}
+
+// Nick is the nick the client registered with.
+func (s *Server) Nick() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nick
+}
+
+func (s *Server) addMember(channel, nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel = strings.ToLower(channel)
+	if s.members[channel] == nil {
+		s.members[channel] = make(map[string]bool)
+	}
+	s.members[channel][nick] = true
+}
+
+// Members lists who's in a channel, sorted.
+func (s *Server) Members(channel string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var nicks []string
+	for nick := range s.members[strings.ToLower(channel)] {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+	return nicks
+}
+
+// AddUser puts nick in a channel without telling the client, so they show up the next time it asks for NAMES.
+func (s *Server) AddUser(channel, nick string) {
+	s.addMember(channel, nick)
+}
+
+// RemoveUser takes nick out of a channel without telling the client, as if they'd left while it wasn't connected.
+func (s *Server) RemoveUser(channel, nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.members[strings.ToLower(channel)], nick)
+}
+
+// Send sends a raw line to the client.
+func (s *Server) Send(line string) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil {
+		s.t.Errorf("irctest: no client to send %q to", line)
+		return
+	}
+	s.write(conn, line)
+}
+
+// Join has nick join a channel.
+func (s *Server) Join(nick, channel string) {
+	s.addMember(channel, nick)
+	s.Send(fmt.Sprintf(":%v!%v@irctest JOIN :%v", nick, nick, channel))
+}
+
+// Say has nick say text to target, which is a channel or the client's nick.
+func (s *Server) Say(nick, target, text string) {
+	s.Send(fmt.Sprintf(":%v!%v@irctest PRIVMSG %v :%v", nick, nick, target, text))
+}
+
+// Action has nick emote to target, as in "/me kicks gobot".
+func (s *Server) Action(nick, target, action string) {
+	s.Say(nick, target, "\x01ACTION "+action+"\x01")
+}
+
+// Expect waits for the client to send a line matching pattern, a regular expression, and returns it. Lines which don't
+// match are skipped. If nothing matches before Timeout, the test fails.
+func (s *Server) Expect(pattern string) string {
+	s.t.Helper()
+	re := regexp.MustCompile(pattern)
+	timeout := time.After(s.Timeout)
+	for {
+		select {
+		case line := <-s.received:
+			if re.MatchString(line) {
+				return line
+			}
+		case <-timeout:
+			s.t.Fatalf("irctest: nothing matching %q after %v", pattern, s.Timeout)
+			return ""
+		}
+	}
+}
+
+// ExpectNone fails the test if the client sends a line matching pattern within d.
+func (s *Server) ExpectNone(pattern string, d time.Duration) {
+	s.t.Helper()
+	re := regexp.MustCompile(pattern)
+	timeout := time.After(d)
+	for {
+		select {
+		case line := <-s.received:
+			if re.MatchString(line) {
+				s.t.Errorf("irctest: got %q; want nothing matching %q", line, pattern)
+				return
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
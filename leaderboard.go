@@ -0,0 +1,310 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+)
+
+const (
+	// maxLineLength is how much text fits in a reply, leaving room for the rest of the PRIVMSG in IRC's 512 bytes.
+	maxLineLength = 400
+	// linesPerPage is how many lines a leaderboard query gets at once. "more" gets the next lot.
+	linesPerPage = 2
+	// defaultBoardSize is how many people top and bottom list, unless asked for more or fewer, up to maxBoardSize.
+	defaultBoardSize = 5
+	maxBoardSize     = 50
+	// maxReasonLength is how much of each reason gets listed.
+	maxReasonLength = 100
+)
+
+// leaderboardRe matches e.g. "gobot, top 10", "gobot: rank bob" or "gobot, more".
+var leaderboardRe = regexp.MustCompile(`^(\S+)[,:] (top|bottom|rank|karma|givers|reasons|more)\b\s*(.*?)\s*$`)
+
+// pager holds what's left to say of long replies, by channel, until someone asks for more.
+type pager struct {
+	pending map[string][]string
+}
+
+func newPager() *pager {
+	return &pager{pending: make(map[string][]string)}
+}
+
+// say replies with the first page of lines, and keeps the rest for later.
+func (p *pager) say(ctx context.Context, bot *IrcBot, msg irc.Message, lines []string) {
+	key := settingsKey(msg.Network, msg.Channel)
+	delete(p.pending, key)
+	if len(lines) > linesPerPage {
+		p.pending[key] = lines[linesPerPage:]
+		lines = lines[:linesPerPage]
+		lines[len(lines)-1] += fmt.Sprintf(" (%d more, say \"%v, more\")", len(p.pending[key]),
+			bot.Network(msg.Network).Nick())
+	}
+	for _, line := range lines {
+		bot.Reply(ctx, msg, line)
+	}
+}
+
+// more says the next page of whatever was last said in msg's channel.
+func (p *pager) more(ctx context.Context, bot *IrcBot, msg irc.Message) {
+	lines := p.pending[settingsKey(msg.Network, msg.Channel)]
+	if len(lines) == 0 {
+		bot.Reply(ctx, msg, "That's all there is.")
+		return
+	}
+	p.say(ctx, bot, msg, lines)
+}
+
+// pack joins items with sep into as few lines as fit within maxLineLength, after prefix on the first.
+func pack(prefix string, items []string, sep string) []string {
+	var lines []string
+	line := prefix
+	for _, item := range items {
+		switch {
+		case line == prefix:
+			line += item
+		case len(line)+len(sep)+len(item) > maxLineLength:
+			lines = append(lines, line)
+			line = item
+		default:
+			line += sep + item
+		}
+	}
+	return append(lines, line)
+}
+
+// ranked is someone's place on the leaderboard.
+type ranked struct {
+	Nick  string
+	Total float64 // which is only fractional when older points are worth less
+	Rank  int     // 1 is the top. People with the same total share a rank.
+}
+
+// Kinds of score, for filtering leaderboards.
+const (
+	everything = ""
+	people     = "people"
+	things     = "things"
+)
+
+// leaderboard returns everyone and everything of the given kind with points in w, including people who aren't
+// around, highest first. Blocked scores are left off.
+func leaderboard(kind string, w window) []ranked {
+	var board []ranked
+	for nick, score := range scoreMap {
+		if karmaAdmin.Blocked[strings.ToLower(nick)] || kind == people && !score.Person || kind == things && score.Person {
+			continue
+		}
+		if w.counts(score) {
+			board = append(board, ranked{Nick: nick, Total: w.score(score)})
+		}
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Total != board[j].Total {
+			return board[i].Total > board[j].Total
+		}
+		return strings.ToLower(board[i].Nick) < strings.ToLower(board[j].Nick)
+	})
+	for i := range board {
+		board[i].Rank = i + 1
+		if i > 0 && board[i].Total == board[i-1].Total {
+			board[i].Rank = board[i-1].Rank
+		}
+	}
+	return board
+}
+
+// lookupScore finds nick's score, ignoring case, and returns the nick as it was first scored.
+func lookupScore(nick string) (string, Score, bool) {
+	if score, ok := scoreMap[nick]; ok {
+		return nick, score, true
+	}
+	for name, score := range scoreMap {
+		if strings.EqualFold(name, nick) {
+			return name, score, true
+		}
+	}
+	return nick, Score{}, false
+}
+
+// handleLeaderboard answers questions about who has how many points, and why.
+func (bot *IrcBot) handleLeaderboard(ctx context.Context, msg irc.Message, pages *pager) (fired, trap bool) {
+	match := leaderboardRe.FindStringSubmatch(msg.Text)
+	if match == nil || !strings.EqualFold(match[1], bot.Network(msg.Network).Nick()) {
+		return
+	}
+	cmd, arg := match[2], match[3]
+
+	var lines []string
+	switch cmd {
+	case "more":
+		pages.more(ctx, bot, msg)
+		return true, true
+	case "top", "bottom":
+		size, kind, w := defaultBoardSize, everything, allTime
+		now, halfLife := bot.localNow(), bot.settings.Duration(msg.Network, msg.Channel, "karma-half-life")
+		for _, word := range strings.Fields(strings.ToLower(arg)) {
+			switch n, err := strconv.Atoi(word); {
+			case err == nil && n > 0:
+				size = n
+			case word == people || word == "person":
+				kind = people
+			case word == things || word == "thing":
+				kind = things
+			case parseWindow(word, now, halfLife, &w):
+			default:
+				bot.Reply(ctx, msg, fmt.Sprintf(
+					"Usage: %v [how many] [people|things] [today|week|month|year|30d|2026-09|decayed]", cmd))
+				return true, true
+			}
+		}
+		if size > maxBoardSize {
+			size = maxBoardSize
+		}
+		lines = boardLines(cmd, size, kind, w)
+	case "rank", "karma", "givers", "reasons":
+		nick := arg
+		if nick == "" {
+			nick = msg.Nick
+		}
+		if strings.ContainsAny(nick, " \t") {
+			bot.Reply(ctx, msg, fmt.Sprintf("Usage: %v [nick]", cmd))
+			return true, true
+		}
+		lines = bot.scoreLines(cmd, nick, bot.timeFormatFor(msg.Network, msg.Nick))
+	}
+	pages.say(ctx, bot, msg, lines)
+	return true, true
+}
+
+// boardLines lists the top or bottom size people, things, or both, in w.
+func boardLines(which string, size int, kind string, w window) []string {
+	board := leaderboard(kind, w)
+	if len(board) == 0 {
+		nobody := map[string]string{
+			everything: "Nobody has a score",
+			people:     "Nobody has a score",
+			things:     "Nothing has a score",
+		}[kind]
+		if w.Name != "" {
+			return []string{fmt.Sprintf("%v from %v.", nobody, w.Name)}
+		}
+		return []string{nobody + " yet!"}
+	}
+	if which == "bottom" {
+		for i, j := 0, len(board)-1; i < j; i, j = i+1, j-1 {
+			board[i], board[j] = board[j], board[i]
+		}
+	}
+	if size > len(board) {
+		size = len(board)
+	}
+	var items []string
+	for _, r := range board[:size] {
+		items = append(items, fmt.Sprintf("%d. %v (%v)", r.Rank, r.Nick, formatScore(r.Total)))
+	}
+	title := map[string]string{"top": "Top", "bottom": "Bottom"}[which]
+	if kind != everything {
+		title += " " + kind
+	}
+	title = fmt.Sprintf("%v %d", title, size)
+	if w.Name != "" {
+		title += ", " + w.Name
+	}
+	return pack(title+": ", items, ", ")
+}
+
+// scoreLines answers rank, karma, givers and reasons about nick, with times shown as f shows them.
+func (bot *IrcBot) scoreLines(cmd, nick string, f timeFormat) []string {
+	nick, score, ok := lookupScore(nick)
+	if !ok {
+		return []string{fmt.Sprintf("%v doesn't have a score yet.", nick)}
+	}
+
+	switch cmd {
+	case "rank":
+		board := leaderboard(everything, allTime)
+		for _, r := range board {
+			if r.Nick == nick {
+				return []string{fmt.Sprintf("%v is #%d of %d, with %v.", nick, r.Rank, len(board), formatScore(r.Total))}
+			}
+		}
+		return []string{fmt.Sprintf("%v isn't ranked, since it's blocked.", nick)}
+
+	case "karma":
+		weekAgo := bot.clock.Now().Add(-7 * 24 * time.Hour)
+		given, taken := 0, 0
+		for _, p := range score.Points {
+			if p.When.Before(weekAgo) {
+				continue
+			}
+			if p.Increase {
+				given++
+			} else {
+				taken++
+			}
+		}
+		trend := "no change this week"
+		if given > 0 || taken > 0 {
+			trend = fmt.Sprintf("%+d this week, %d up and %d down", given-taken, given, taken)
+		}
+		return []string{fmt.Sprintf("%v has %d (%v).", nick, score.Total, trend)}
+
+	case "givers":
+		net := make(map[string]int)
+		for _, p := range score.Points {
+			if p.Increase {
+				net[p.Granter]++
+			} else {
+				net[p.Granter]--
+			}
+		}
+		granters := make([]string, 0, len(net))
+		for granter := range net {
+			granters = append(granters, granter)
+		}
+		// Biggest fans first, harshest critics last.
+		sort.Slice(granters, func(i, j int) bool {
+			a, b := granters[i], granters[j]
+			if net[a] != net[b] {
+				return net[a] > net[b]
+			}
+			return strings.ToLower(a) < strings.ToLower(b)
+		})
+		var items []string
+		for _, granter := range granters {
+			items = append(items, fmt.Sprintf("%v %+d", granter, net[granter]))
+		}
+		return pack(fmt.Sprintf("%v's points came from ", nick), items, ", ")
+
+	case "reasons":
+		var items []string
+		// Newest first.
+		for i := len(score.Points) - 1; i >= 0; i-- {
+			p := score.Points[i]
+			if p.Reason == "" {
+				continue
+			}
+			sign := "-"
+			if p.Increase {
+				sign = "+"
+			}
+			reason := p.Reason
+			if len(reason) > maxReasonLength {
+				reason = strings.ToValidUTF8(reason[:maxReasonLength], "") + "…"
+			}
+			items = append(items, fmt.Sprintf("%v%v (%v, %v)", sign, reason, p.Granter, f.day(p.When)))
+		}
+		if len(items) == 0 {
+			return []string{fmt.Sprintf("Nobody's said why %v has points.", nick)}
+		}
+		return pack(fmt.Sprintf("Why %v has points: ", nick), items, "; ")
+	}
+	return nil
+}
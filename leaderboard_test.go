@@ -0,0 +1,144 @@
+package youandmeandirc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+// leaderboardNow is when leaderboard tests happen.
+var leaderboardNow = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// setLeaderboardScores gives a few people and things scores from the last couple of months.
+func setLeaderboardScores() {
+	point := func(granter string, up bool, daysAgo int, reason string) Point {
+		return Point{Granter: granter, When: leaderboardNow.AddDate(0, 0, -daysAgo), Reason: reason, Increase: up}
+	}
+	scoreMap = map[string]Score{
+		"alice": {Total: 1, Person: true, Points: []Point{point("bob", true, 10, "")}},
+		"bob": {Total: 3, Person: true, Points: []Point{
+			point("alice", true, 30, "lunch"), point("alice", true, 2, ""), point("carol", true, 1, "the build")}},
+		"carol":   {Total: 1, Person: true, Points: []Point{point("alice", true, 40, "")}},
+		"dave":    {Total: -2, Person: true, Points: []Point{point("bob", false, 50, ""), point("alice", false, 60, "")}},
+		"mondays": {Total: -1, Points: []Point{point("alice", false, 1, "")}},
+		"golang":  {Total: 2, Points: []Point{point("alice", true, 1, ""), point("bob", true, 1, "")}},
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"gobot, top", []string{"Top 5: 1. bob (3), 2. golang (2), 3. alice (1), 3. carol (1), 5. mondays (-1)"}},
+		{"gobot, top 2", []string{"Top 2: 1. bob (3), 2. golang (2)"}},
+		{"gobot, top 2 people", []string{"Top people 2: 1. bob (3), 2. alice (1)"}},
+		{"gobot, bottom things", []string{"Bottom things 2: 2. mondays (-1), 1. golang (2)"}},
+		{"gobot, bottom 1", []string{"Bottom 1: 6. dave (-2)"}},
+		{"gobot, scores?", []string{"Top 5: 1. bob (3), 2. golang (2), 3. alice (1), 3. carol (1), 5. mondays (-1)"}},
+		{"gobot, top lots", []string{"Usage: top [how many] [people|things] [today|week|month|year|30d|2026-09|decayed]"}},
+		{"gobot, top this week", []string{"Top 3, last 7 days: 1. bob (2), 1. golang (2), 3. mondays (-1)"}},
+		{"gobot, top things this month", []string{"Top things 2, last 30 days: 1. golang (2), 2. mondays (-1)"}},
+		{"gobot, top 2026-09", []string{"Top 2, September 2026: 1. bob (1), 1. carol (1)"}},
+		{"gobot, top 2026-01", []string{"Nobody has a score from January 2026."}},
+		{"gobot, top decayed", []string{
+			"Top 5, with a half-life of 720h: 1. bob (2.4), 2. golang (2.0), 3. alice (0.8), 4. carol (0.4), 5. dave (-0.6)"}},
+		{"gobot, rank carol", []string{"carol is #3 of 6, with 1."}},
+		// dave's not here, but he still counts.
+		{"gobot, rank DAVE", []string{"dave is #6 of 6, with -2."}},
+		{"gobot, rank", []string{"alice is #3 of 6, with 1."}},
+		{"gobot, rank erin", []string{"erin doesn't have a score yet."}},
+		{"gobot, karma bob", []string{"bob has 3 (+2 this week, 2 up and 0 down)."}},
+		{"gobot, karma carol", []string{"carol has 1 (no change this week)."}},
+		{"gobot, givers bob", []string{"bob's points came from alice +2, carol +1"}},
+		{"gobot, givers dave", []string{"dave's points came from alice -1, bob -1"}},
+		{"gobot, reasons bob", []string{"Why bob has points: +the build (carol, Oct 18); +lunch (alice, Sep 19)"}},
+		{"gobot, reasons dave", []string{"Nobody's said why dave has points."}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			bot, n, client := newTestBot(t)
+			bot.SetClock(irctest.NewClock(leaderboardNow))
+			setLeaderboardScores()
+			n.addMember("#test", "alice", time.Time{})
+			n.addMember("#test", "bob", time.Time{})
+
+			bot.runListeners(privmsg("alice", test.text))
+			flush(n)
+			if got := client.Said("#test"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("said %q; want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLeaderboardPaging(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	scoreMap = make(map[string]Score)
+	for i := 0; i < maxBoardSize; i++ {
+		scoreMap[fmt.Sprintf("someone-with-a-long-nick-%02d", i)] = Score{Total: i}
+	}
+
+	bot.runListeners(privmsg("alice", "gobot, top 50"))
+	flush(n)
+	first := client.Said("#test")
+	if len(first) != linesPerPage || !strings.HasSuffix(last(first), `more, say "gobot, more")`) {
+		t.Fatalf("said %q; want %d lines, ending with how to get more", first, linesPerPage)
+	}
+	for _, line := range first {
+		if len(line) > maxLineLength+len(` (99 more, say "gobot, more")`) {
+			t.Errorf("%q is %d long; want it to fit in %d", line, len(line), maxLineLength)
+		}
+	}
+
+	client.Reset()
+	for i := 0; i < 3; i++ {
+		bot.runListeners(privmsg("bob", "gobot, more"))
+	}
+	flush(n)
+	said := client.Said("#test")
+	if got := last(said); got != "That's all there is." {
+		t.Errorf("the last more => %q; want to hear that's all", got)
+	}
+	all := strings.Join(append(first, said...), " ")
+	for i := 0; i < maxBoardSize; i++ {
+		if nick := fmt.Sprintf("someone-with-a-long-nick-%02d", i); !strings.Contains(all, nick) {
+			t.Errorf("%v wasn't listed on any page", nick)
+		}
+	}
+}
+
+func TestMonthlyRecap(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(leaderboardNow)
+	bot.SetClock(clock)
+	bot.SetAdmins([]string{"alice"})
+	setLeaderboardScores()
+
+	bot.runListeners(privmsg("alice", "gobot, recap on"))
+	bot.runListeners(privmsg("alice", "gobot, recap on"))
+	// Run up to nine on the first of November.
+	clock.Advance(time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC).Sub(clock.Now()))
+	bot.runDueJobs()
+	bot.runListeners(privmsg("alice", "gobot, recap off"))
+	flush(n)
+
+	want := []string{
+		"OK, I'll sum up each month's karma in #test on the first.",
+		"#test already gets a recap every month.",
+		"Karma for October 2026: top bob (+2), golang (+2), alice (+1). Bottom: mondays (-1). Busiest: alice, with 3.",
+		"OK, no more recaps in #test.",
+	}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if jobs := bot.Jobs(nil); len(jobs) != 0 {
+		t.Errorf("jobs left after recap off => %+v; want none", jobs)
+	}
+}
@@ -0,0 +1,163 @@
+// Package logging gives each part of the bot its own structured logger, whose level can be changed while the bot is
+// running. Parts of the bot are either subsystems, like conn or parser, or modules, like score. Each has a name, and
+// unless its level has been set, it logs at the default level, which starts at info.
+//
+//	var log = logging.Subsystem("conn")
+//	log.Debug("Sending", "line", line)
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default is the name used to set the level of everything which doesn't have its own.
+const Default = "default"
+
+var (
+	mu           sync.RWMutex // guards the variables below
+	defaultLevel = slog.LevelInfo
+	levels       = make(map[string]slog.Level)
+	out          = io.Writer(os.Stderr)
+)
+
+// Subsystem returns a logger for a part of the bot that isn't a module, such as conn. Its lines have a subsystem
+// attribute.
+func Subsystem(name string) *slog.Logger {
+	return newLogger(name, slog.String("subsystem", name))
+}
+
+// Module returns a logger for a module. Its lines have a module attribute.
+func Module(name string) *slog.Logger {
+	return newLogger(name, slog.String("module", name))
+}
+
+func newLogger(name string, attr slog.Attr) *slog.Logger {
+	return slog.New(&handler{name: name, h: slog.NewTextHandler(writer{}, nil).WithAttrs([]slog.Attr{attr})})
+}
+
+// Level is the level name logs at.
+func Level(name string) slog.Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	if l, ok := levels[name]; ok {
+		return l
+	}
+	return defaultLevel
+}
+
+// SetLevel changes the level name logs at. Setting Default's level changes it for everything without its own.
+func SetLevel(name string, l slog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	if name == Default {
+		defaultLevel = l
+		return
+	}
+	levels[name] = l
+}
+
+// ResetLevel has name go back to logging at the default level.
+func ResetLevel(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if name == Default {
+		defaultLevel = slog.LevelInfo
+		return
+	}
+	delete(levels, name)
+}
+
+// SetLevels replaces every level with those in ls, which maps names to levels such as "debug" or "warn".
+func SetLevels(ls map[string]string) error {
+	parsed, err := ParseLevels(ls)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	defaultLevel = slog.LevelInfo
+	levels = make(map[string]slog.Level)
+	for name, l := range parsed {
+		if name == Default {
+			defaultLevel = l
+		} else {
+			levels[name] = l
+		}
+	}
+	return nil
+}
+
+// ParseLevels parses level names, e.g. {"conn": "debug"}.
+func ParseLevels(ls map[string]string) (map[string]slog.Level, error) {
+	parsed := make(map[string]slog.Level)
+	for name, s := range ls {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(s)); err != nil {
+			return nil, fmt.Errorf("log level for %v: %q isn't debug, info, warn or error", name, s)
+		}
+		parsed[name] = l
+	}
+	return parsed, nil
+}
+
+// Describe lists the levels which have been set, e.g. "default=INFO, conn=DEBUG".
+func Describe() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(levels))
+	for name := range levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{fmt.Sprintf("%v=%v", Default, defaultLevel)}
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%v=%v", name, levels[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SetOutput changes where every logger writes. It's stderr to begin with.
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+}
+
+// writer writes to out, whatever it is at the time.
+type writer struct{}
+
+func (writer) Write(p []byte) (int, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return out.Write(p)
+}
+
+// handler drops records below its name's level and passes the rest to h.
+type handler struct {
+	name string
+	h    slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= Level(h.name)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.h.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{name: h.name, h: h.h.WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{name: h.name, h: h.h.WithGroup(name)}
+}
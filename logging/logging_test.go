@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	t.Cleanup(func() {
+		SetOutput(os.Stderr)
+		SetLevels(nil)
+	})
+
+	conn, score := Subsystem("conn"), Module("score")
+	if err := SetLevels(map[string]string{Default: "warn", "conn": "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	conn.Debug("Sending", "line", "NICK gobot")
+	score.Info("Score change", "nick", "bob")
+	score.Warn("Unable to save")
+
+	got := buf.String()
+	for _, want := range []string{
+		`level=DEBUG msg=Sending subsystem=conn line="NICK gobot"`,
+		`level=WARN msg="Unable to save" module=score`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log is %q; want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "Score change") {
+		t.Errorf("log is %q; want nothing from score below warn", got)
+	}
+
+	buf.Reset()
+	SetLevel("score", slog.LevelInfo)
+	score.Info("Score change", "nick", "bob")
+	ResetLevel("conn")
+	conn.Debug("Sending", "line", "NICK gobot")
+	if got := buf.String(); !strings.Contains(got, "Score change") || strings.Contains(got, "Sending") {
+		t.Errorf("after changing levels, log is %q; want only the score change", got)
+	}
+
+	if got, want := Describe(), "default=WARN, score=INFO"; got != want {
+		t.Errorf("Describe() => %q; want %q", got, want)
+	}
+	if err := SetLevels(map[string]string{"conn": "chatty"}); err == nil {
+		t.Errorf("SetLevels(chatty) => nil; want error")
+	}
+}
@@ -0,0 +1,183 @@
+package youandmeandirc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var membersLog = logging.Module("members")
+
+// foldCase folds s the way casemapping says to, so that two nicks or channels the server treats as the same fold to
+// the same thing. rfc1459, which servers assume unless they say otherwise, treats []\~ as the upper case of {}|^;
+// strict-rfc1459 leaves out ~ and ^, and ascii only folds letters.
+func foldCase(casemapping, s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case casemapping == "ascii":
+		case r == '[':
+			return '{'
+		case r == ']':
+			return '}'
+		case r == '\\':
+			return '|'
+		case r == '~' && casemapping != "strict-rfc1459":
+			return '^'
+		}
+		return r
+	}, s)
+}
+
+// fold folds a nick or channel name the way n's server does.
+func (n *Network) fold(s string) string {
+	return foldCase(n.casemapping, s)
+}
+
+// sameNick reports whether n's server treats a and b as the same nick or channel.
+func (n *Network) sameNick(a, b string) bool {
+	return n.fold(a) == n.fold(b)
+}
+
+// Members returns who's in channel, as far as the bot knows.
+func (n *Network) Members(channel string) []string {
+	var nicks []string
+	for nick := range n.members[n.fold(channel)] {
+		nicks = append(nicks, nick)
+	}
+	return nicks
+}
+
+// inChannel reports whether nick is in channel, as far as the bot knows.
+func (n *Network) inChannel(channel, nick string) bool {
+	for member := range n.members[n.fold(channel)] {
+		if n.sameNick(member, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPresent reports whether nick is in any of the bot's channels on n.
+func (n *Network) isPresent(nick string) bool {
+	for channel := range n.members {
+		if n.inChannel(channel, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// arrivedAt is when nick was seen joining channel. ok is false if nick isn't there, or was there before the bot.
+func (n *Network) arrivedAt(channel, nick string) (at time.Time, ok bool) {
+	for member, at := range n.members[n.fold(channel)] {
+		if n.sameNick(member, nick) {
+			return at, !at.IsZero()
+		}
+	}
+	return time.Time{}, false
+}
+
+// addMember notes that nick is in channel, and arrived at the given time, or zero if it's not known when.
+func (n *Network) addMember(channel, nick string, at time.Time) {
+	key := n.fold(channel)
+	if n.members[key] == nil {
+		n.members[key] = make(map[string]time.Time)
+	}
+	n.members[key][nick] = at
+}
+
+// removeMember notes that nick has left channel. If it's the bot that left, it forgets everyone there.
+func (n *Network) removeMember(channel, nick string) {
+	if n.sameNick(nick, n.Nick()) {
+		delete(n.members, n.fold(channel))
+		return
+	}
+	for member := range n.members[n.fold(channel)] {
+		if n.sameNick(member, nick) {
+			delete(n.members[n.fold(channel)], member)
+		}
+	}
+}
+
+// membersListener keeps track of who's in which channel and since when, from NAMES replies and people coming and
+// going, and who last said something in each, and of how the server folds case. It doesn't trap anything, and runs
+// before any module that might, so it sees everything.
+func (bot *IrcBot) membersListener(n *Network) (members Listener) {
+	n.members = make(map[string]map[string]time.Time)
+	n.spoke = make(map[string]map[string]time.Time)
+	bot.persist("spoke-"+n.Name, &n.spoke)
+
+	members = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+		switch msg.Command {
+		case irc.Privmsg:
+			// What people say to the bot in private doesn't count.
+			if !isChannel(msg.Channel) {
+				return
+			}
+			channel := n.fold(msg.Channel)
+			if n.spoke[channel] == nil {
+				n.spoke[channel] = make(map[string]time.Time)
+			}
+			n.spoke[channel][msg.Nick] = bot.clock.Now()
+		case irc.Join:
+			n.addMember(msg.Channel, msg.Nick, bot.clock.Now())
+		case irc.Part:
+			n.removeMember(msg.Channel, msg.Nick)
+		case irc.Kick:
+			if len(msg.Args) > 0 {
+				n.removeMember(msg.Channel, msg.Args[0])
+			}
+		case irc.Quit:
+			for channel := range n.members {
+				n.removeMember(channel, msg.Nick)
+			}
+		case irc.Nick:
+			for _, nicks := range n.members {
+				for member, at := range nicks {
+					if n.sameNick(member, msg.Nick) {
+						delete(nicks, member)
+						nicks[msg.Text] = at
+						break
+					}
+				}
+			}
+		case irc.Num:
+			switch msg.Code {
+			case "001": // Welcome: a new connection, so whoever was around before may not be now.
+				membersLog.Debug("Connected, forgetting who was around", "network", n.Name)
+				n.members = make(map[string]map[string]time.Time)
+			case "353": // NAMES: nick = #channel :@alice +bob carol
+				if len(msg.Args) == 0 {
+					return
+				}
+				channel := msg.Args[len(msg.Args)-1]
+				names := strings.Fields(msg.Text)
+				for _, name := range names {
+					// Whoever's here already, we don't know when they arrived.
+					if nick := strings.TrimLeft(name, "~&@%+"); !n.inChannel(channel, nick) {
+						n.addMember(channel, nick, time.Time{})
+					}
+				}
+				membersLog.Debug("Got names", "network", n.Name, "channel", channel, "count", len(names))
+			case "005": // ISUPPORT: nick CHANTYPES=# CASEMAPPING=rfc1459 ... :are supported by this server
+				for _, token := range msg.Args {
+					if v, ok := strings.CutPrefix(token, "CASEMAPPING="); ok {
+						membersLog.Debug("Server casemapping", "network", n.Name, "casemapping", v)
+						n.casemapping = v
+					}
+				}
+			default:
+				return
+			}
+		default:
+			return
+		}
+		return true, false
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package youandmeandirc
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+)
+
+func TestFoldCase(t *testing.T) {
+	tests := []struct {
+		casemapping, in, want string
+	}{
+		{"", "Alice[Away]", "alice{away}"},
+		{"rfc1459", `Bob\Home~`, "bob|home^"},
+		{"strict-rfc1459", `Bob\Home~`, "bob|home~"},
+		{"ascii", `Bob[\]~`, `bob[\]~`},
+		{"rfc1459", "#Go-Nuts", "#go-nuts"},
+	}
+	for _, test := range tests {
+		if got := foldCase(test.casemapping, test.in); got != test.want {
+			t.Errorf("foldCase(%q, %q) => %q; want %q", test.casemapping, test.in, got, test.want)
+		}
+	}
+}
+
+func TestMembers(t *testing.T) {
+	bot, n, _ := newTestBot(t)
+	for _, line := range []string{
+		":irctest 353 gobot = #test :gobot @alice +bob carol",
+		":irctest 353 gobot = #Other :gobot alice",
+		":dave!dave@test JOIN #test",
+		":bob!bob@test PART #test :bye",
+		":alice!alice@test KICK #test carol :spam",
+		":ALICE!alice@test NICK :alice|away",
+		":dave!dave@test QUIT :Ping timeout",
+		":erin!erin@test JOIN :#other",
+	} {
+		msg := *irc.NewMessage(line)
+		msg.Network = "test"
+		bot.runListeners(msg)
+	}
+
+	for channel, want := range map[string][]string{
+		"#test":  {"alice|away", "gobot"},
+		"#OTHER": {"alice|away", "erin", "gobot"},
+	} {
+		got := n.Members(channel)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Members(%q) => %q; want %q", channel, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package youandmeandirc
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/metrics"
+)
+
+// botMetrics are the metrics the bot keeps about itself, as opposed to those modules keep.
+type botMetrics struct {
+	received *metrics.Counter   // by network and command
+	handled  *metrics.Counter   // by module
+	fired    *metrics.Counter   // by module
+	trapped  *metrics.Counter   // by module
+	panics   *metrics.Counter   // by module
+	overran  *metrics.Counter   // by module
+	dropped  *metrics.Counter   // by module
+	latency  *metrics.Histogram // by module
+}
+
+func (bot *IrcBot) initMetrics() {
+	reg := metrics.NewRegistry()
+	bot.registry = reg
+	bot.metrics = botMetrics{
+		received: reg.Counter("gobot_messages_received_total", "Messages read from servers.", "network", "command"),
+		handled:  reg.Counter("gobot_module_handled_total", "Messages passed to each module.", "module"),
+		fired:    reg.Counter("gobot_module_fired_total", "Messages each module fired on.", "module"),
+		trapped:  reg.Counter("gobot_module_trapped_total", "Messages each module kept from later modules.", "module"),
+		panics:   reg.Counter("gobot_module_panics_total", "Times each module panicked.", "module"),
+		overran:  reg.Counter("gobot_module_overran_total", "Times each module took longer than its deadline.", "module"),
+		dropped:  reg.Counter("gobot_module_dropped_total", "Messages async modules were too busy to handle.", "module"),
+		latency: reg.Histogram("gobot_module_handler_seconds", "How long each module took to handle a message.",
+			metrics.DefaultBuckets, "module"),
+	}
+
+	perNetwork := func(fn func(n *Network) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, n := range bot.sortedNetworks() {
+				samples = append(samples, metrics.Sample{LabelValues: []string{n.Name}, Value: fn(n)})
+			}
+			return samples
+		}
+	}
+	reg.GaugeFunc("gobot_send_queue_depth", "Lines waiting to be sent.",
+		perNetwork(func(n *Network) float64 { return float64(n.queue.pending()) }), "network")
+	reg.GaugeFunc("gobot_lag_seconds", "Round trip time to the server.",
+		perNetwork(func(n *Network) float64 { return n.Lag().Seconds() }), "network")
+	reg.CounterFunc("gobot_reconnects_total", "Times the bot has had to reconnect.",
+		perNetwork(func(n *Network) float64 { return float64(n.Reconnects()) }), "network")
+}
+
+// sortedNetworks returns the bot's networks, sorted by name. Networks are only added before the bot starts, so this
+// is safe to call from any goroutine after that.
+func (bot *IrcBot) sortedNetworks() []*Network {
+	var names []string
+	for name := range bot.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var networks []*Network
+	for _, name := range names {
+		networks = append(networks, bot.networks[name])
+	}
+	return networks
+}
+
+// commandName is how a message's command shows up in metrics, e.g. PRIVMSG or 353.
+func commandName(msg irc.Message) string {
+	if msg.Command == irc.Num {
+		return msg.Code
+	}
+	return msg.Command.String()
+}
+
+// ModuleMetrics is a module's handle for keeping its own metrics, which it's given when it's built; see Module.New.
+// Names are prefixed with gobot_ and the module's name, so the score module's "points_total" is exported as
+// gobot_score_points_total. Metrics should be created once, when the listener is built, rather than on every
+// message.
+type ModuleMetrics struct {
+	prefix string
+	reg    *metrics.Registry
+}
+
+// Metrics returns the named module's metrics handle, as passed to its Module.New. Per-network modules can ask for the
+// same metric on every network; they share it, so give it a network label if it matters.
+func (bot *IrcBot) Metrics(module string) ModuleMetrics {
+	return ModuleMetrics{"gobot_" + module + "_", bot.registry}
+}
+
+func (m ModuleMetrics) Counter(name, help string, labels ...string) *metrics.Counter {
+	return m.reg.Counter(m.prefix+name, help, labels...)
+}
+
+func (m ModuleMetrics) Gauge(name, help string, labels ...string) *metrics.Gauge {
+	return m.reg.Gauge(m.prefix+name, help, labels...)
+}
+
+func (m ModuleMetrics) Histogram(name, help string, buckets []float64, labels ...string) *metrics.Histogram {
+	return m.reg.Histogram(m.prefix+name, help, buckets, labels...)
+}
+
+// metricsHandler serves every metric in the Prometheus text format.
+func (bot *IrcBot) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := bot.registry.WriteText(w); err != nil {
+		statusLog.Warn("Unable to write metrics", "err", err)
+	}
+}
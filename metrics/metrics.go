@@ -0,0 +1,373 @@
+// Package metrics keeps counters, gauges and histograms, and writes them out in the Prometheus text format. It's
+// just enough for the bot, without pulling in the Prometheus client.
+//
+//	reg := metrics.NewRegistry()
+//	received := reg.Counter("gobot_messages_received_total", "Messages read from servers.", "network", "command")
+//	received.Inc("libera", "PRIVMSG")
+//	reg.WriteText(w)
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sample is a single value of a metric, for the label values given.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// DefaultBuckets are histogram buckets for handler latencies, in seconds.
+var DefaultBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// Registry holds metrics, by name.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// family is one named metric, which can be written out.
+type family interface {
+	write(w io.Writer) error
+}
+
+// register adds the metric built by newFamily, unless there's already one called name, in which case that's returned
+// instead. That way, per-network modules can all ask for the same metric.
+func (r *Registry) register(name string, newFamily func() family) family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	f := newFamily()
+	r.families[name] = f
+	return f
+}
+
+func mismatch(name, kind string) string {
+	return fmt.Sprintf("metrics: %v is already registered as something other than a %v", name, kind)
+}
+
+// WriteText writes every metric in the Prometheus text format, sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desc is what every metric has.
+type desc struct {
+	name   string
+	help   string
+	kind   string // counter, gauge or histogram
+	labels []string
+}
+
+func (d desc) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", d.name, strings.ReplaceAll(d.help, "\n", " "), d.name, d.kind)
+	return err
+}
+
+// series formats name{label="value",...} for the given values, plus any extra label.
+func (d desc) series(name string, values []string, extra ...string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	pairs := append(append([]string(nil), interleave(d.labels, values)...), extra...)
+	if len(pairs) == 0 {
+		return b.String()
+	}
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%v=\"%v\"", pairs[i], escape(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func interleave(labels, values []string) []string {
+	pairs := make([]string, 0, 2*len(labels))
+	for i, l := range labels {
+		pairs = append(pairs, l, values[i])
+	}
+	return pairs
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// key joins label values into a map key.
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func (d desc) check(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %v wants %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+// values keeps a value per set of label values, remembering the order they were first seen in.
+type values struct {
+	mu     sync.Mutex
+	order  []string
+	labels map[string][]string
+	values map[string]float64
+}
+
+func (vs *values) add(labelValues []string, delta float64, set bool) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.values == nil {
+		vs.labels = make(map[string][]string)
+		vs.values = make(map[string]float64)
+	}
+	k := key(labelValues)
+	if _, ok := vs.values[k]; !ok {
+		vs.order = append(vs.order, k)
+		vs.labels[k] = append([]string(nil), labelValues...)
+	}
+	if set {
+		vs.values[k] = delta
+	} else {
+		vs.values[k] += delta
+	}
+}
+
+func (vs *values) get(labelValues []string) float64 {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	return vs.values[key(labelValues)]
+}
+
+func (vs *values) samples() []Sample {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	var samples []Sample
+	for _, k := range vs.order {
+		samples = append(samples, Sample{vs.labels[k], vs.values[k]})
+	}
+	return samples
+}
+
+func writeSamples(w io.Writer, d desc, samples []Sample) error {
+	if err := d.header(w); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		d.check(s.LabelValues)
+		if _, err := fmt.Fprintf(w, "%v %v\n", d.series(d.name, s.LabelValues), formatValue(s.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counter is a count which only goes up, kept separately for each set of label values.
+type Counter struct {
+	desc
+	values values
+}
+
+// Counter registers a counter with the given labels, or returns the one already registered as name.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c, ok := r.register(name, func() family {
+		return &Counter{desc: desc{name, help, "counter", labels}}
+	}).(*Counter)
+	if !ok {
+		panic(mismatch(name, "counter"))
+	}
+	return c
+}
+
+// Inc adds one to the count for labelValues, which go with the counter's labels in order.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.check(labelValues)
+	c.values.add(labelValues, v, false)
+}
+
+// Value is the count so far for labelValues.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.values.get(labelValues)
+}
+
+func (c *Counter) write(w io.Writer) error {
+	return writeSamples(w, c.desc, c.values.samples())
+}
+
+// Gauge is a value which goes up and down, kept separately for each set of label values.
+type Gauge struct {
+	desc
+	values values
+}
+
+// Gauge registers a gauge with the given labels, or returns the one already registered as name.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g, ok := r.register(name, func() family {
+		return &Gauge{desc: desc{name, help, "gauge", labels}}
+	}).(*Gauge)
+	if !ok {
+		panic(mismatch(name, "gauge"))
+	}
+	return g
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.check(labelValues)
+	g.values.add(labelValues, v, true)
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.check(labelValues)
+	g.values.add(labelValues, v, false)
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	return writeSamples(w, g.desc, g.values.samples())
+}
+
+// funcFamily is a counter or gauge whose values come from a function, called whenever metrics are written.
+type funcFamily struct {
+	desc
+	fn func() []Sample
+}
+
+// GaugeFunc registers a gauge whose samples come from fn, for values that are easier to look up than to keep up to
+// date, such as queue lengths. If there's already a metric called name, fn is ignored.
+func (r *Registry) GaugeFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(name, func() family { return &funcFamily{desc{name, help, "gauge", labels}, fn} })
+}
+
+// CounterFunc is like GaugeFunc, for counts kept somewhere else.
+func (r *Registry) CounterFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(name, func() family { return &funcFamily{desc{name, help, "counter", labels}, fn} })
+}
+
+func (f *funcFamily) write(w io.Writer) error {
+	return writeSamples(w, f.desc, f.fn())
+}
+
+// Histogram counts observations, such as how long something took, in buckets.
+type Histogram struct {
+	desc
+	buckets []float64 // upper bounds, ascending
+
+	mu     sync.Mutex
+	order  []string
+	labels map[string][]string
+	data   map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Histogram registers a histogram with the given bucket upper bounds, which must be ascending, and labels, or returns
+// the one already registered as name.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h, ok := r.register(name, func() family {
+		return &Histogram{
+			desc:    desc{name, help, "histogram", labels},
+			buckets: buckets,
+			labels:  make(map[string][]string),
+			data:    make(map[string]*histogramSeries),
+		}
+	}).(*Histogram)
+	if !ok {
+		panic(mismatch(name, "histogram"))
+	}
+	return h
+}
+
+// Observe records v for labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.check(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := key(labelValues)
+	s, ok := h.data[k]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.data[k] = s
+		h.order = append(h.order, k)
+		h.labels[k] = append([]string(nil), labelValues...)
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	if err := h.header(w); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range h.order {
+		s, values := h.data[k], h.labels[k]
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			if _, err := fmt.Fprintf(w, "%v %v\n", h.series(h.name+"_bucket", values, "le", formatValue(le)), cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%v %v\n%v %v\n",
+			h.series(h.name+"_sum", values), formatValue(s.sum),
+			h.series(h.name+"_count", values), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
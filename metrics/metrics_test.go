@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	received := reg.Counter("messages_total", "Messages read.", "network", "command")
+	received.Inc("home", "PRIVMSG")
+	received.Inc("home", "PRIVMSG")
+	received.Add(3, "libera", `we"ird`)
+	reg.Gauge("depth", "Lines queued.").Set(4)
+	reg.GaugeFunc("lag_seconds", "Lag.", func() []Sample {
+		return []Sample{{[]string{"home"}, 0.25}}
+	}, "network")
+	latency := reg.Histogram("handler_seconds", "Handler latency.", []float64{.01, .1}, "module")
+	latency.Observe(.005, "score")
+	latency.Observe(.05, "score")
+	latency.Observe(2, "score")
+
+	// Asking again gets the same counter.
+	reg.Counter("messages_total", "Messages read.", "network", "command").Inc("home", "PRIVMSG")
+	if got := received.Value("home", "PRIVMSG"); got != 3 {
+		t.Errorf("Value(home, PRIVMSG) => %v; want 3", got)
+	}
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP depth Lines queued.
+# TYPE depth gauge
+depth 4
+# HELP handler_seconds Handler latency.
+# TYPE handler_seconds histogram
+handler_seconds_bucket{module="score",le="0.01"} 1
+handler_seconds_bucket{module="score",le="0.1"} 2
+handler_seconds_bucket{module="score",le="+Inf"} 3
+handler_seconds_sum{module="score"} 2.055
+handler_seconds_count{module="score"} 3
+# HELP lag_seconds Lag.
+# TYPE lag_seconds gauge
+lag_seconds{network="home"} 0.25
+# HELP messages_total Messages read.
+# TYPE messages_total counter
+messages_total{network="home",command="PRIVMSG"} 3
+messages_total{network="libera",command="we\"ird"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =>\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestRegisteringAsSomethingElsePanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("things_total", "Things.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Gauge(things_total) didn't panic")
+		}
+	}()
+	reg.Gauge("things_total", "Things.")
+}
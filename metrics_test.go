@@ -0,0 +1,33 @@
+package youandmeandirc
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	bot, n, _ := newTestBot(t)
+	n.addMember("#test", "bob", time.Time{})
+	bot.runListeners(privmsg("alice", "bob++"))
+	bot.runListeners(privmsg("alice", "just chatting"))
+
+	w := httptest.NewRecorder()
+	bot.metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	got := w.Body.String()
+	for _, want := range []string{
+		`gobot_messages_received_total{network="test",command="PRIVMSG"} 2`,
+		`gobot_module_handled_total{module="score"} 2`,
+		`gobot_module_fired_total{module="score"} 1`,
+		`gobot_module_trapped_total{module="score"} 1`,
+		`gobot_module_handler_seconds_count{module="score"} 2`,
+		`gobot_score_points_total{direction="given"} 1`,
+		`gobot_send_queue_depth{network="test"} 1`,
+		`gobot_reconnects_total{network="test"} 0`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics don't include %q:\n%v", want, got)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package youandmeandirc
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var netLog = logging.Subsystem("network")
+
+// Bounds on how long to wait between failed attempts to connect.
+const (
+	minReconnectDelay = 5 * time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+// Defaults for keepalive. We ping the server every pingInterval, and give up on the connection if a PONG hasn't come
+// back after pingTimeout.
+const (
+	defaultPingInterval = time.Minute
+	defaultPingTimeout  = 2 * time.Minute
+)
+
+// Network is a single IRC network the bot is connected to. Each network has its own connection, reconnect loop
+// and flood control, so trouble on one doesn't hold up the others. Messages from a network are tagged with its
+// Name.
+type Network struct {
+	Name string
+
+	dial  ConnectFn
+	queue *sendQueue
+	clock Clock
+	// transcript is where the connection's traffic is recorded, if anywhere. It's closed once the bot has quit.
+	transcript io.Closer
+
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+
+	// listeners are this network's instances of the bot's modules, in registration order.
+	listeners []moduleListener
+
+	// State kept per network on behalf of modules. Only touched from the bot's dispatch loop.
+	seen   map[string]SeenInfo
+	health map[string]int // combat hit points, by nick
+	// spoke is when each nick last said something in each channel, by folded channel name.
+	spoke map[string]map[string]time.Time
+	// members is who's in each channel, by folded channel name, and when they were seen joining it, or zero for
+	// whoever was there before the bot. It starts over on each connection. casemapping is how the server folds nicks
+	// and channel names, as it said in its ISUPPORT; see foldCase.
+	members     map[string]map[string]time.Time
+	casemapping string
+
+	mu       sync.Mutex // guards the fields below
+	channels []string
+	conn     Client
+	joined   bool
+	joinedAt time.Time
+	// reconnects counts connections after the first.
+	reconnects int
+
+	// The PING we're waiting on a PONG for, if any, and the last round trip we measured.
+	pingToken string
+	pingSent  time.Time
+	lag       time.Duration
+}
+
+func newNetwork(name string, channels []string, dial ConnectFn) *Network {
+	return &Network{
+		Name:     name,
+		channels: channels,
+		dial:     dial,
+		queue:    newSendQueue(defaultFloodBurst, defaultFloodInterval),
+		clock:    realClock{},
+
+		pingInterval: defaultPingInterval,
+		pingTimeout:  defaultPingTimeout,
+	}
+}
+
+// SetFloodControl changes how many lines can be sent in a burst, and how often lines go out after that. It's safe to
+// call while the network is running.
+func (n *Network) SetFloodControl(burst int, interval time.Duration) {
+	n.queue.setGate(floodGate{burst: burst, interval: interval})
+}
+
+// setTranscript sets where the connection's traffic is recorded, closing wherever it was recorded before.
+func (n *Network) setTranscript(t io.Closer) {
+	if n.transcript != nil {
+		if err := n.transcript.Close(); err != nil {
+			netLog.Warn("Unable to close transcript", "network", n.Name, "err", err)
+		}
+	}
+	n.transcript = t
+}
+
+func (n *Network) setClock(c Clock) {
+	n.clock = c
+	n.queue.clock = c
+}
+
+// SetKeepalive changes how often the server is pinged, and how long to wait for a reply before reconnecting.
+func (n *Network) SetKeepalive(interval, timeout time.Duration) {
+	n.pingInterval, n.pingTimeout = interval, timeout
+}
+
+// Lag is the round trip time to the server as of the last PING, or how long we've been waiting on the current one if
+// that's longer. It's zero until the first PONG.
+func (n *Network) Lag() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pingToken != "" {
+		if waiting := n.clock.Since(n.pingSent); waiting > n.lag {
+			return waiting
+		}
+	}
+	return n.lag
+}
+
+func (n *Network) client() Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.conn
+}
+
+func (n *Network) setClient(c Client) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.conn = c
+}
+
+// Channels returns the channels the bot joins on this network.
+func (n *Network) Channels() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.channels...)
+}
+
+// setChannels changes the channels the bot should be in. If it's already joined its channels, it joins and parts to
+// match.
+func (n *Network) setChannels(channels []string) {
+	n.mu.Lock()
+	old, joined := n.channels, n.joined
+	n.channels = channels
+	n.mu.Unlock()
+
+	if !joined {
+		return
+	}
+	for _, c := range channels {
+		if !hasFold(old, c) {
+			n.Join(c)
+		}
+	}
+	for _, c := range old {
+		if !hasFold(channels, c) {
+			n.Part(c, "Reconfigured")
+		}
+	}
+}
+
+// Reconnects is how many times the bot has had to connect to this network again.
+func (n *Network) Reconnects() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.reconnects
+}
+
+// Nick returns the bot's nick on this network.
+func (n *Network) Nick() string {
+	c := n.client()
+	if c == nil {
+		return ""
+	}
+	return c.Nick()
+}
+
+// Uptime is how long the bot has been in its channels on this network.
+func (n *Network) Uptime() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.clock.Since(n.joinedAt)
+}
+
+// Say queues a message to a channel. If ctx is done, say because the handler saying it took too long, the message is
+// dropped instead.
+func (n *Network) Say(ctx context.Context, channel, chat string) {
+	if err := ctx.Err(); err != nil {
+		netLog.Info("Dropping reply from a cancelled handler", "network", n.Name, "channel", channel, "err", err)
+		return
+	}
+	n.queue.push(func(c Client) error {
+		return c.Say(channel, chat)
+	})
+}
+
+// Notice queues a notice to a channel or nick, unless ctx is done, like Say.
+func (n *Network) Notice(ctx context.Context, target, text string) {
+	if err := ctx.Err(); err != nil {
+		netLog.Info("Dropping notice from a cancelled handler", "network", n.Name, "target", target, "err", err)
+		return
+	}
+	n.queue.push(func(c Client) error {
+		return c.Notice(target, text)
+	})
+}
+
+// Join queues a request to join a channel.
+func (n *Network) Join(channel string) {
+	n.queue.push(func(c Client) error {
+		return c.Join(channel)
+	})
+}
+
+// Part queues a request to leave a channel.
+func (n *Network) Part(channel, message string) {
+	n.queue.push(func(c Client) error {
+		return c.Part(channel, message)
+	})
+}
+
+// Names queues a request for the list of nicks in a channel.
+func (n *Network) Names(channel string) {
+	n.queue.push(func(c Client) error {
+		return c.Names(channel)
+	})
+}
+
+// run connects to the network and passes everything it reads to inbox, reconnecting whenever the connection drops.
+// It returns once ctx is done and the connection has been closed by quit.
+func (n *Network) run(ctx context.Context, inbox chan<- irc.Message) {
+	go n.queue.run(n.Name, n.client)
+
+	delay := minReconnectDelay
+	connected := false
+	for ctx.Err() == nil {
+		c, err := n.dial()
+		if err != nil {
+			netLog.Warn("Unable to connect, retrying", "network", n.Name, "delay", delay, "err", err)
+			select {
+			case <-n.clock.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+		delay = minReconnectDelay
+
+		if connected {
+			n.mu.Lock()
+			n.reconnects++
+			n.mu.Unlock()
+		}
+		connected = true
+		n.setClient(c)
+		n.read(ctx, c, inbox)
+		n.setClient(nil)
+		n.mu.Lock()
+		n.joined = false
+		n.mu.Unlock()
+		c.Close()
+		if ctx.Err() == nil {
+			netLog.Warn("Disconnected, reconnecting", "network", n.Name)
+		}
+	}
+}
+
+// quit says goodbye to the server and hangs up, which ends run.
+func (n *Network) quit(message string) error {
+	c := n.client()
+	if c == nil {
+		return nil
+	}
+	err := c.Quit(message)
+	c.Close()
+	return err
+}
+
+// keepalive pings the server every pingInterval until ctx is done. If a PONG hasn't come back pingTimeout after a
+// PING, it hangs up, which makes run reconnect. It wakes up for whichever of those is due first, so a timeout shorter
+// than the interval counts too.
+func (n *Network) keepalive(ctx context.Context, c Client) {
+	nextPing := n.clock.Now().Add(n.pingInterval)
+	for {
+		n.mu.Lock()
+		waiting, sent := n.pingToken != "", n.pingSent
+		n.mu.Unlock()
+
+		wake := nextPing
+		if deadline := sent.Add(n.pingTimeout); waiting && deadline.Before(wake) {
+			wake = deadline
+		}
+		select {
+		case <-n.clock.After(wake.Sub(n.clock.Now())):
+		case <-ctx.Done():
+			return
+		}
+
+		now := n.clock.Now()
+		n.mu.Lock()
+		waiting, since := n.pingToken != "", now.Sub(n.pingSent)
+		n.mu.Unlock()
+		if waiting && since >= n.pingTimeout {
+			netLog.Warn("No PONG, connection is dead", "network", n.Name, "since", since.Round(time.Second))
+			c.Close()
+			return
+		}
+		if now.Before(nextPing) {
+			continue
+		}
+		nextPing = now.Add(n.pingInterval)
+		if waiting {
+			// Still waiting on the last one, which has a while to go yet.
+			continue
+		}
+
+		token := strconv.FormatInt(now.UnixNano(), 10)
+		n.mu.Lock()
+		n.pingToken, n.pingSent = token, now
+		n.mu.Unlock()
+		// This skips the send queue, so the lag we measure is the server's and not ours.
+		if err := c.Ping(token); err != nil {
+			netLog.Warn("Unable to ping server", "network", n.Name, "err", err)
+		}
+	}
+}
+
+// gotPong records the lag if token is from the PING we're waiting on.
+func (n *Network) gotPong(token string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if token == "" || token != n.pingToken {
+		return
+	}
+	n.lag = n.clock.Since(n.pingSent)
+	n.pingToken = ""
+}
+
+// registered joins our channels once the server has let us in, and asks who's in them.
+func (n *Network) registered() {
+	channels := n.Channels()
+	for _, channel := range channels {
+		n.Join(channel)
+	}
+	// Sorta dumb, but basically don't count uptime until we've joined a channel.
+	n.mu.Lock()
+	n.joinedAt = n.clock.Now()
+	n.joined = true
+	n.mu.Unlock()
+	// Collect a list of names.
+	for _, channel := range channels {
+		n.Names(channel)
+	}
+}
+
+// read passes messages from c to inbox until there's an error, or ctx is done.
+func (n *Network) read(ctx context.Context, c *irc.Conn, inbox chan<- irc.Message) {
+	kctx, stop := context.WithCancel(ctx)
+	defer stop()
+	n.mu.Lock()
+	n.pingToken = ""
+	n.mu.Unlock()
+	go n.keepalive(kctx, c)
+
+	joined := false
+	for {
+		m, err := c.Read()
+		if err != nil {
+			netLog.Warn("Unable to read from server", "network", n.Name, "err", err)
+			return
+		}
+
+		if m.Command == irc.Pong {
+			n.gotPong(m.Text)
+			continue
+		}
+
+		// TODO: uh, look at the actual codes so we know when we've joined. This is a bit hacky.
+		if !joined && m.Nick == c.Nick() && m.Command == irc.Mode {
+			n.registered()
+			joined = true
+			continue
+		}
+
+		m.Network = n.Name
+		select {
+		case inbox <- *m:
+		case <-ctx.Done():
+			// The bot's no longer listening. Keep reading until quit hangs up, so the server doesn't block on us.
+		}
+	}
+}
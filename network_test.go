@@ -0,0 +1,80 @@
+package youandmeandirc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestKeepalive(t *testing.T) {
+	tests := []struct {
+		name              string
+		interval, timeout time.Duration
+		// deadAfter is how long after the PING the connection should be given up on.
+		deadAfter time.Duration
+	}{
+		{"timeout longer than interval", time.Minute, 150 * time.Second, 150 * time.Second},
+		{"timeout shorter than interval", time.Minute, 10 * time.Second, 10 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := irctest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+			n := newNetwork("test", nil, nil)
+			n.setClock(clock)
+			n.SetKeepalive(test.interval, test.timeout)
+			client := irctest.NewClient("gobot")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				n.keepalive(ctx, client)
+				close(done)
+			}()
+
+			// Step through in seconds, so a late wakeup would show up as a late hangup.
+			waitForWaiter(t, clock)
+			clock.Advance(test.interval)
+			for elapsed := time.Duration(0); !client.Closed(); elapsed += time.Second {
+				if elapsed > test.deadAfter {
+					t.Fatalf("still connected %v after the first PING; want it given up on after %v", elapsed,
+						test.deadAfter)
+				}
+				waitForWaiter(t, clock)
+				clock.Advance(time.Second)
+				waitForDoneOrWaiter(clock, done)
+			}
+			<-done
+
+			// There's no second PING while the first is still waiting on a PONG.
+			if lines := client.Lines(); len(lines) != 1 || !strings.HasPrefix(lines[0], "PING ") {
+				t.Errorf("sent %q; want a single PING", lines)
+			}
+		})
+	}
+}
+
+// waitForWaiter waits for something to be waiting on clock.
+func waitForWaiter(t *testing.T, clock *irctest.Clock) {
+	t.Helper()
+	for i := 0; clock.Waiters() == 0; i++ {
+		if i == 1000 {
+			t.Fatal("nothing's waiting on the clock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitForDoneOrWaiter waits until done is closed, or something is waiting on clock again.
+func waitForDoneOrWaiter(clock *irctest.Clock, done <-chan struct{}) {
+	for clock.Waiters() == 0 {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
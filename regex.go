@@ -1,28 +1,16 @@
 package youandmeandirc
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
 
 	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
 )
 
-type RegexTrigger struct{}
-
-func (t RegexTrigger) Id() TriggerId {
-	return TriggerId("regex")
-}
-
-func (t RegexTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
-	fn := bot.combatListener()
-	fired, _ := fn(msg)
-	if fired {
-		return Fired
-	}
-	return Pass
-}
+var regexLog = logging.Module("regex")
 
 type Replacement struct {
 	search  string
@@ -47,8 +35,19 @@ func regex(msg string) *Replacement {
 	return nil
 }
 
+// RegexTrigger fires the regex module. See Trigger.
+type RegexTrigger struct{}
+
+func (t RegexTrigger) Id() TriggerId {
+	return TriggerId("regex")
+}
+
+func (t RegexTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
+	return bot.fireModule("regex", msg)
+}
+
 func (bot *IrcBot) regexListener() (l Listener) {
-	l = func(msg irc.Message) (fired, trap bool) {
+	l = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
 		if msg.Command != irc.Privmsg {
 			return
 		}
@@ -63,26 +62,26 @@ func (bot *IrcBot) regexListener() (l Listener) {
 
 		res := regex(head)
 		if res == nil {
-			log.Printf("Doesn't look like a regex: %q\n", head)
 			return
 		}
 
 		// Retrieve the last message we saw from this user and apply it.
-		seen, ok := bot.seenList[msg.Nick]
+		_, info := findSeen(bot.Network(msg.Network), msg.Nick)
+		said, ok := info[Spoke]
 		if !ok {
-			log.Printf("User supplied regex but they haven't been seen until now: %v", msg.Nick)
+			regexLog.Debug("Got a regex from someone we haven't seen say anything", "nick", msg.Nick)
 			return
 		}
 
 		re, err := regexp.Compile(res.search)
 		if err != nil {
-			log.Printf("Invalid regex %q: %v", head, err)
+			regexLog.Debug("Invalid regex", "regex", head, "err", err)
 			return
 		}
 
-		replaced := re.ReplaceAllString(seen.Message.Text, res.replace)
+		replaced := re.ReplaceAllString(said.Text, res.replace)
 		chat := fmt.Sprintf("%v actually meant: %v", msg.Nick, replaced)
-		bot.irc.Say(msg.Channel, chat)
+		bot.Network(msg.Network).Say(ctx, msg.Channel, chat)
 
 		return true, true
 	}
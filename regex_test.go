@@ -62,3 +62,16 @@ func TestHasRegex(t *testing.T) {
 // 		{"hello wrold", "s/wrold/world", "hello world"},
 // 	}
 // }
+
+func TestRegexFoldsNicks(t *testing.T) {
+	bot, n, client := newTestBot(t)
+
+	bot.runListeners(privmsg("[Alice]", "hello wrold"))
+	bot.runListeners(privmsg("{alice}", "s/wrold/world/"))
+	flush(n)
+
+	want := []string{"{alice} actually meant: hello world"}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said %q; want %q", got, want)
+	}
+}
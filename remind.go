@@ -0,0 +1,98 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+)
+
+// maxReminders is how many reminders one nick can have waiting.
+const maxReminders = 10
+
+// remindRe matches e.g. "gobot, remind me in 10m to stretch" or "gobot: remind me every 24h to water the plants".
+var remindRe = regexp.MustCompile(`^(\S+)[,:] remind me (in|every) (\S+) (?:to )?(.+)$`)
+
+// forgetRe matches e.g. "gobot, forget reminder 3".
+var forgetRe = regexp.MustCompile(`^(\S+)[,:] forget reminder #?(\d+)$`)
+
+// remindListener has the bot remind people of things later, in the channel they asked in.
+func (bot *IrcBot) remindListener() (remind Listener) {
+	remind = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+		if msg.Command != irc.Privmsg {
+			return
+		}
+		n := bot.Network(msg.Network)
+		theirs := func(job Job) bool {
+			return job.Network == msg.Network && job.Kind == "say" && strings.EqualFold(job.Data["nick"], msg.Nick)
+		}
+
+		if strings.EqualFold(msg.Text, n.Nick()+", reminders") || strings.EqualFold(msg.Text, n.Nick()+": reminders") {
+			jobs := bot.Jobs(theirs)
+			if len(jobs) == 0 {
+				n.Say(ctx, msg.Channel, fmt.Sprintf("%v: You don't have any reminders.", msg.Nick))
+				return true, true
+			}
+			var parts []string
+			f := bot.timeFormatFor(msg.Network, msg.Nick)
+			for _, job := range jobs {
+				parts = append(parts, fmt.Sprintf("#%d at %v: %v", job.ID, f.at(job.At), job.Data["what"]))
+			}
+			n.Say(ctx, msg.Channel, fmt.Sprintf("%v: %v", msg.Nick, strings.Join(parts, "; ")))
+			return true, true
+		}
+
+		if match := forgetRe.FindStringSubmatch(msg.Text); match != nil && strings.EqualFold(match[1], n.Nick()) {
+			id, _ := strconv.Atoi(match[2])
+			for _, job := range bot.Jobs(theirs) {
+				if job.ID == id {
+					bot.Cancel(id)
+					n.Say(ctx, msg.Channel, fmt.Sprintf("%v: OK, forgotten.", msg.Nick))
+					return true, true
+				}
+			}
+			n.Say(ctx, msg.Channel, fmt.Sprintf("%v: You don't have a reminder #%d.", msg.Nick, id))
+			return true, true
+		}
+
+		match := remindRe.FindStringSubmatch(msg.Text)
+		if match == nil || !strings.EqualFold(match[1], n.Nick()) {
+			return
+		}
+		d, err := time.ParseDuration(match[3])
+		if err != nil || d <= 0 {
+			n.Say(ctx, msg.Channel, fmt.Sprintf("%v: I don't know how long %q is. Try something like 10m or 2h30m.",
+				msg.Nick, match[3]))
+			return true, true
+		}
+		if len(bot.Jobs(theirs)) >= maxReminders {
+			n.Say(ctx, msg.Channel, fmt.Sprintf("%v: You've already got %d reminders. Forget one first.", msg.Nick, maxReminders))
+			return true, true
+		}
+
+		job := Job{
+			Kind:    "say",
+			Network: msg.Network,
+			Target:  msg.Channel,
+			Text:    fmt.Sprintf("%v: %v", msg.Nick, match[4]),
+			Data:    map[string]string{"nick": msg.Nick, "what": match[4]},
+			At:      bot.clock.Now().Add(d),
+		}
+		if match[2] == "every" {
+			job.Every = "@every " + match[3]
+		}
+		id, err := bot.Schedule(job)
+		if err != nil {
+			n.Say(ctx, msg.Channel, fmt.Sprintf("%v: I can't do that: %v.", msg.Nick, err))
+			return true, true
+		}
+		n.Say(ctx, msg.Channel, fmt.Sprintf("%v: OK, I'll remind you at %v. (That's reminder #%d.)",
+			msg.Nick, bot.timeFormatFor(msg.Network, msg.Nick).at(job.At), id))
+		return true, true
+	}
+	return
+}
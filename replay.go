@@ -0,0 +1,195 @@
+package youandmeandirc
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var replayLog = logging.Subsystem("replay")
+
+// Feed hands msg, a line read from network, to the bot as if it had just arrived, then writes whatever the bot queued
+// in reply straight to c, ignoring flood control. It's for driving a bot without connecting it anywhere, such as when
+// replaying a transcript: c stands in for the connection, and the server's MODE for the bot's nick registers it, so
+// it joins its channels as usual.
+//
+// The bot mustn't be started.
+func (bot *IrcBot) Feed(network string, c Client, msg irc.Message) {
+	n := bot.Network(network)
+	if n == nil {
+		n = bot.AddNetwork(network, nil, nil)
+	}
+	if n.client() != c {
+		n.setClient(c)
+	}
+
+	n.mu.Lock()
+	joined := n.joined
+	n.mu.Unlock()
+	switch {
+	case msg.Command == irc.Pong:
+	case !joined && msg.Nick == c.Nick() && msg.Command == irc.Mode:
+		n.registered()
+	default:
+		msg.Network = network
+		bot.runListeners(msg)
+	}
+	n.queue.drain(c)
+}
+
+// SetSeed reseeds the bot's RNG, so that whatever it picks at random is the same every time. It should be called
+// before the bot starts.
+func (bot *IrcBot) SetSeed(seed int64) {
+	bot.rng = rand.New(rand.NewSource(seed))
+}
+
+// Replay feeds a transcript recorded on network back through the bot's modules, as if it were happening again, and
+// returns what the bot said at the time along with what it says now. Only PRIVMSG and NOTICE lines are compared;
+// JOINs, PINGs and the like are the network's business, not the modules'.
+//
+// The bot mustn't be started. Its clock follows the transcript, and its RNG is seeded the same way every time, so a
+// replay is repeatable, although combat rolls won't match what happened live.
+func (bot *IrcBot) Replay(network string, entries []irc.Entry) (recorded, replayed []string) {
+	client := &replayClient{nick: transcriptNick(entries)}
+	bot.SetSeed(1)
+	clock := &replayClock{}
+	if len(entries) > 0 {
+		clock.now = entries[0].Time
+	}
+	bot.SetClock(clock)
+
+	for _, e := range entries {
+		if e.Direction == irc.Outbound {
+			if isChat(e.Line) {
+				recorded = append(recorded, e.Line)
+			}
+			continue
+		}
+		clock.catchUp(e.Time)
+
+		m, err := irc.ParseMessage(e.Line)
+		if err != nil {
+			// Conn.Read would have skipped it too.
+			continue
+		}
+		bot.Feed(network, client, *m)
+	}
+
+	for _, line := range client.lines {
+		if isChat(line) {
+			replayed = append(replayed, line)
+		}
+	}
+	return recorded, replayed
+}
+
+// transcriptNick is the nick the bot registered with in a transcript.
+func transcriptNick(entries []irc.Entry) string {
+	for _, e := range entries {
+		if e.Direction == irc.Outbound && strings.HasPrefix(e.Line, "NICK ") {
+			return strings.TrimPrefix(e.Line, "NICK ")
+		}
+	}
+	replayLog.Warn("No NICK in the transcript; replies to the bot by name won't work")
+	return ""
+}
+
+// isChat reports whether an outbound line is something said to a channel or person.
+func isChat(line string) bool {
+	return strings.HasPrefix(line, "PRIVMSG ") || strings.HasPrefix(line, "NOTICE ")
+}
+
+// replayClient stands in for the connection during a replay, keeping the lines the bot sends instead of sending them.
+type replayClient struct {
+	nick  string
+	lines []string
+}
+
+func (c *replayClient) send(format string, a ...interface{}) error {
+	c.lines = append(c.lines, fmt.Sprintf(format, a...))
+	return nil
+}
+
+func (c *replayClient) Nick() string {
+	return c.nick
+}
+
+func (c *replayClient) Say(channel, chat string) error {
+	return c.send("PRIVMSG %v :%v", channel, chat)
+}
+
+func (c *replayClient) Notice(target, text string) error {
+	return c.send("NOTICE %v :%v", target, text)
+}
+
+func (c *replayClient) Join(channel string) error {
+	return c.send("JOIN %v", channel)
+}
+
+func (c *replayClient) Part(channel, message string) error {
+	return c.send("PART %v :%v", channel, message)
+}
+
+func (c *replayClient) Names(channel string) error {
+	return c.send("NAMES %v", channel)
+}
+
+func (c *replayClient) Ping(token string) error {
+	return c.send("PING :%v", token)
+}
+
+func (c *replayClient) Quit(message string) error {
+	return c.send("QUIT :%v", message)
+}
+
+func (c *replayClient) Close() error {
+	return nil
+}
+
+// replayClock is the time as of the transcript line being replayed. Waiting, as for pretend typing, moves it on
+// instead of taking any time, and so does the next line.
+type replayClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *replayClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *replayClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *replayClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// After fires straight away, having moved the clock on: nothing runs in the background during a replay, so there's
+// nothing else for time to pass for.
+func (c *replayClock) After(d time.Duration) <-chan time.Time {
+	if d > 0 {
+		c.Sleep(d)
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+// catchUp moves the clock on to t, unless it's already past it.
+func (c *replayClock) catchUp(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
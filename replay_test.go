@@ -0,0 +1,71 @@
+package youandmeandirc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestFeed(t *testing.T) {
+	bot, _, _ := newTestBot(t)
+	client := irctest.NewClient("gobot")
+
+	for _, line := range []string{
+		":irctest 001 gobot :Welcome to irctest, gobot",
+		":gobot MODE gobot :+i",
+		":irctest 353 gobot = #test :alice bob gobot",
+		":alice!alice@irctest PRIVMSG #test :bob++",
+		":irctest PONG irctest :1234",
+	} {
+		bot.Feed("test", client, *irc.NewMessage(line))
+	}
+
+	want := []string{"JOIN #test", "NAMES #test", "PRIVMSG #test :bob's score is now 1"}
+	if got := client.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q; want %q", got, want)
+	}
+}
+
+const testTranscript = `2026-10-19T12:00:00Z => NICK gobot
+2026-10-19T12:00:00Z => USER gobot * * :...
+2026-10-19T12:00:01Z <= :irctest 001 gobot :Welcome to irctest, gobot
+2026-10-19T12:00:01Z <= :gobot MODE gobot :+i
+2026-10-19T12:00:01Z => JOIN #test
+2026-10-19T12:00:01Z <= :gobot!gobot@irctest JOIN :#test
+2026-10-19T12:00:01Z <= :irctest 353 gobot = #test :alice bob gobot
+2026-10-19T12:00:01Z <= :irctest 366 gobot #test :End of /NAMES list.
+2026-10-19T12:00:05Z <= :alice!alice@irctest PRIVMSG #test :bob++
+2026-10-19T12:00:05Z => PRIVMSG #test :bob's score is now 1
+2026-10-19T12:00:09Z <= :alice!alice@irctest PRIVMSG #test :hello wrold
+2026-10-19T12:00:10Z <= :alice!alice@irctest PRIVMSG #test :s/wrold/world/
+2026-10-19T12:00:10Z => PRIVMSG #test :alice actually meant: hello wrld
+`
+
+func TestReplayTranscript(t *testing.T) {
+	entries, err := irc.ReadTranscript(strings.NewReader(testTranscript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoreMap = make(map[string]Score)
+	bot, err := NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, replayed := bot.Replay("test", entries)
+	if want := []string{
+		"PRIVMSG #test :bob's score is now 1",
+		"PRIVMSG #test :alice actually meant: hello wrld",
+	}; !reflect.DeepEqual(recorded, want) {
+		t.Errorf("recorded %q; want %q", recorded, want)
+	}
+	if want := []string{
+		"PRIVMSG #test :bob's score is now 1",
+		"PRIVMSG #test :alice actually meant: hello world",
+	}; !reflect.DeepEqual(replayed, want) {
+		t.Errorf("replayed %q; want %q", replayed, want)
+	}
+}
@@ -0,0 +1,186 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var schedLog = logging.Subsystem("scheduler")
+
+// schedulerTick is how often the scheduler looks for jobs which are due.
+const schedulerTick = time.Second
+
+// Job is something for the bot to do later, once or over and over. Jobs are kept in the state directory, so they
+// have to be plain data: what to do is up to the JobFunc registered for the job's kind.
+type Job struct {
+	ID int `json:"id"`
+	// Kind says what runs the job. The bot knows "say", which says Text to Target.
+	Kind    string `json:"kind"`
+	Network string `json:"network"`
+	// Target is the channel or nick the job is about, if any.
+	Target string            `json:"target,omitempty"`
+	Text   string            `json:"text,omitempty"`
+	Data   map[string]string `json:"data,omitempty"`
+	// At is when the job next runs.
+	At time.Time `json:"at"`
+	// Every is how often the job recurs, as understood by parseRecurrence, e.g. "@daily" or "0 9 * * 1". Jobs
+	// without it run once.
+	Every string `json:"every,omitempty"`
+}
+
+// JobFunc runs a job. Like a Listener, it runs on the dispatch loop and anything it says after ctx is done is dropped.
+type JobFunc func(ctx context.Context, job Job)
+
+// schedule is the bot's jobs, soonest first.
+type schedule struct {
+	NextID int   `json:"next_id"`
+	Jobs   []Job `json:"jobs"`
+}
+
+// jobKey is where a JobFunc is kept. Jobs for per-network modules are run by that network's JobFunc, so network is
+// empty for kinds which any network's jobs share.
+type jobKey struct {
+	network, kind string
+}
+
+// HandleJobs has fn run jobs of the given kind. Per-network modules should pass their network, so that each network's
+// jobs go to its own listener's state; shared modules pass "".
+func (bot *IrcBot) HandleJobs(network, kind string, fn JobFunc) {
+	bot.jobFuncs[jobKey{network, kind}] = fn
+}
+
+func (bot *IrcBot) jobFunc(job Job) (JobFunc, bool) {
+	if fn, ok := bot.jobFuncs[jobKey{job.Network, job.Kind}]; ok {
+		return fn, true
+	}
+	fn, ok := bot.jobFuncs[jobKey{"", job.Kind}]
+	return fn, ok
+}
+
+// Schedule adds a job and returns its ID. If the job recurs and At isn't set, it first runs when Every next comes
+// around. Like everything else touching module state, it has to be called from the dispatch loop.
+func (bot *IrcBot) Schedule(job Job) (int, error) {
+	if job.Every != "" {
+		r, err := parseRecurrence(job.Every)
+		if err != nil {
+			return 0, err
+		}
+		if job.At.IsZero() {
+			job.At = r.next(bot.localNow())
+		}
+	}
+	if job.At.IsZero() {
+		return 0, fmt.Errorf("job has no time to run at")
+	}
+	bot.schedule.NextID++
+	job.ID = bot.schedule.NextID
+	bot.addJob(job)
+	schedLog.Debug("Scheduled job", "id", job.ID, "kind", job.Kind, "at", job.At, "every", job.Every)
+	return job.ID, nil
+}
+
+// addJob puts job in the schedule, keeping it sorted.
+func (bot *IrcBot) addJob(job Job) {
+	jobs := bot.schedule.Jobs
+	i := sort.Search(len(jobs), func(i int) bool { return jobs[i].At.After(job.At) })
+	jobs = append(jobs, Job{})
+	copy(jobs[i+1:], jobs[i:])
+	jobs[i] = job
+	bot.schedule.Jobs = jobs
+}
+
+// Cancel removes the job with the given ID, and reports whether there was one.
+func (bot *IrcBot) Cancel(id int) bool {
+	for i, job := range bot.schedule.Jobs {
+		if job.ID == id {
+			bot.schedule.Jobs = append(bot.schedule.Jobs[:i], bot.schedule.Jobs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Jobs returns the jobs for which keep returns true, soonest first. A nil keep means all of them.
+func (bot *IrcBot) Jobs(keep func(Job) bool) []Job {
+	var jobs []Job
+	for _, job := range bot.schedule.Jobs {
+		if keep == nil || keep(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// runDueJobs runs every job whose time has come. Recurring jobs are put back for their next time; if the bot was down
+// when they should have run, they run once to catch up rather than once for every time they missed.
+func (bot *IrcBot) runDueJobs() {
+	now := bot.localNow()
+	for len(bot.schedule.Jobs) > 0 && !bot.schedule.Jobs[0].At.After(now) {
+		job := bot.schedule.Jobs[0]
+		bot.schedule.Jobs = bot.schedule.Jobs[1:]
+		if job.Every != "" {
+			bot.reschedule(job, now)
+		}
+		bot.runJob(job)
+	}
+}
+
+func (bot *IrcBot) reschedule(job Job, now time.Time) {
+	r, err := parseRecurrence(job.Every)
+	if err != nil {
+		schedLog.Error("Dropping job which doesn't parse", "id", job.ID, "kind", job.Kind, "every", job.Every, "err", err)
+		return
+	}
+	if job.At = r.next(now); job.At.IsZero() {
+		schedLog.Warn("Job will never run again", "id", job.ID, "kind", job.Kind, "every", job.Every)
+		return
+	}
+	bot.addJob(job)
+}
+
+// runJob runs job through its JobFunc. A JobFunc which panics doesn't take the scheduler down with it.
+func (bot *IrcBot) runJob(job Job) {
+	fn, ok := bot.jobFunc(job)
+	if !ok {
+		schedLog.Warn("Nothing handles this kind of job, skipping it", "id", job.ID, "kind", job.Kind,
+			"network", job.Network)
+		return
+	}
+	if bot.Network(job.Network) == nil {
+		schedLog.Warn("Job is for a network the bot isn't on, skipping it", "id", job.ID, "network", job.Network)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			schedLog.Error("Panic running job", "id", job.ID, "kind", job.Kind, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	ctx, cancel := bot.handlerContext()
+	defer cancel()
+	schedLog.Debug("Running job", "id", job.ID, "kind", job.Kind, "network", job.Network, "target", job.Target)
+	fn(ctx, job)
+}
+
+// runScheduler runs jobs on the dispatch loop as they come due, until ctx is done.
+func (bot *IrcBot) runScheduler(ctx context.Context) {
+	for {
+		select {
+		case <-bot.clock.After(schedulerTick):
+			if err := bot.do(bot.runDueJobs); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sayJob is the "say" kind of job.
+func (bot *IrcBot) sayJob(ctx context.Context, job Job) {
+	bot.Network(job.Network).Say(ctx, job.Target, job.Text)
+}
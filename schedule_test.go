@@ -0,0 +1,136 @@
+package youandmeandirc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestScheduler(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+
+	var ran []string
+	bot.HandleJobs("", "note", func(ctx context.Context, job Job) {
+		ran = append(ran, job.Text)
+	})
+	schedule := func(job Job) int {
+		t.Helper()
+		id, err := bot.Schedule(job)
+		if err != nil {
+			t.Fatalf("Schedule(%+v) => %v", job, err)
+		}
+		return id
+	}
+	schedule(Job{Kind: "note", Network: "test", Text: "later", At: clock.Now().Add(2 * time.Hour)})
+	schedule(Job{Kind: "note", Network: "test", Text: "soon", At: clock.Now().Add(time.Hour)})
+	schedule(Job{Kind: "note", Network: "test", Text: "hourly", Every: "@hourly"})
+	cancelled := schedule(Job{Kind: "note", Network: "test", Text: "never", At: clock.Now().Add(time.Hour)})
+	schedule(Job{Kind: "say", Network: "test", Target: "#test", Text: "hello", At: clock.Now().Add(time.Minute)})
+
+	if !bot.Cancel(cancelled) {
+		t.Errorf("Cancel(%d) => false; want true", cancelled)
+	}
+	if bot.Cancel(cancelled) {
+		t.Errorf("Cancel(%d) twice => true; want false", cancelled)
+	}
+
+	bot.runDueJobs()
+	if len(ran) != 0 {
+		t.Errorf("ran %q before anything was due", ran)
+	}
+
+	clock.Advance(time.Hour)
+	bot.runDueJobs()
+	if want := []string{"soon", "hourly"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("after an hour, ran %q; want %q", ran, want)
+	}
+
+	// Missed runs only run once.
+	ran = nil
+	clock.Advance(3 * time.Hour)
+	bot.runDueJobs()
+	if want := []string{"later", "hourly"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("after four hours, ran %q; want %q", ran, want)
+	}
+	if jobs := bot.Jobs(nil); len(jobs) != 1 || jobs[0].Text != "hourly" || !jobs[0].At.Equal(clock.Now().Truncate(time.Hour).Add(time.Hour)) {
+		t.Errorf("jobs left => %+v; want just the hourly one, on the next hour", jobs)
+	}
+
+	flush(n)
+	if got := client.Said("#test"); !reflect.DeepEqual(got, []string{"hello"}) {
+		t.Errorf("said %q; want the say job's text", got)
+	}
+
+	if _, err := bot.Schedule(Job{Kind: "note", Network: "test"}); err == nil {
+		t.Errorf("Schedule() a job without a time => no error")
+	}
+	if _, err := bot.Schedule(Job{Kind: "note", Network: "test", Every: "whenever"}); err == nil {
+		t.Errorf("Schedule() a job which recurs whenever => no error")
+	}
+}
+
+func TestScheduleIsPersisted(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)
+
+	before, _, _ := newTestBot(t)
+	if err := before.SetStateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	before.Schedule(Job{Kind: "say", Network: "test", Target: "#test", Text: "still here", At: at})
+	if err := before.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, n, client := newTestBot(t)
+	if err := after.SetStateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	after.SetClock(irctest.NewClock(at))
+	after.runDueJobs()
+	flush(n)
+	if got := client.Said("#test"); !reflect.DeepEqual(got, []string{"still here"}) {
+		t.Errorf("said %q after a restart; want the job to have been kept", got)
+	}
+	if id, _ := after.Schedule(Job{Kind: "say", Network: "test", At: at}); id != 2 {
+		t.Errorf("the next job's ID => %d; want 2, carrying on from before", id)
+	}
+}
+
+func TestRemind(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+
+	for _, text := range []string{
+		"gobot, remind me in 10m to stretch",
+		"gobot, remind me in soon to stretch",
+		"gobot, reminders",
+	} {
+		bot.runListeners(privmsg("alice", text))
+	}
+	bot.runListeners(privmsg("bob", "gobot, forget reminder 1"))
+	clock.Advance(10 * time.Minute)
+	bot.runDueJobs()
+	bot.runListeners(privmsg("alice", "gobot, reminders"))
+	flush(n)
+
+	want := []string{
+		"alice: OK, I'll remind you at Oct 19 12:10 UTC. (That's reminder #1.)",
+		`alice: I don't know how long "soon" is. Try something like 10m or 2h30m.`,
+		"alice: #1 at Oct 19 12:10 UTC: stretch",
+		"bob: You don't have a reminder #1.",
+		"alice: stretch",
+		"alice: You don't have any reminders.",
+	}
+	got := client.Said("#test")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("said:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
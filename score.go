@@ -1,65 +1,162 @@
 package youandmeandirc
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+	"github.com/wonderzombie/youandmeandirc/metrics"
 )
 
-type ScoreTrigger struct{}
-
-func (t ScoreTrigger) Id() TriggerId {
-	return TriggerId("score")
-}
-
-func (t ScoreTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
-	fn := bot.scoreListener()
-	fired, _ := fn(msg)
-	if fired {
-		return Fired
-	}
-	return Pass
-}
+var scoreLog = logging.Module("score")
 
 type Point struct {
 	Granter string
 	When    time.Time
-	// TODO: Reason doesn't really do anything now. Need access to stuff in seen.go to fix this.
+	// Reason is what the granter said the point was for, as in "bob++ for fixing the build". It's often empty.
 	Reason   string
 	Increase bool
+	// Network is where Granter gave the point. It's empty for points from before it was recorded, or imported.
+	Network string `json:",omitempty"`
 }
 
 type Score struct {
 	Total  int
 	Points []Point
+	// Person is whether this is someone's score, rather than a thing's. Anyone who was around when their score
+	// changed is a person.
+	Person bool `json:",omitempty"`
+}
+
+// karmaRe matches a score change: a word, or some words in parentheses, followed by ++ or --. Where it may start and
+// end is checked separately, by parseKarma.
+var karmaRe = regexp.MustCompile(`\(([^()]+)\)(\+\+|--)|([\w\-\[\]\\^{}|.]+)(\+\+|--)`)
+
+// ignoredRe matches the parts of a line which aren't karma, whatever they look like: code, as in `i++`, and URLs.
+var ignoredRe = regexp.MustCompile("`[^`]*`|\\b[a-zA-Z][a-zA-Z0-9+.-]*://\\S+|\\bwww\\.\\S+")
+
+// reasonRe matches the start of a reason after a score change, as in "bob++ for fixing the build" or "bob++ # oops".
+var reasonRe = regexp.MustCompile(`^\s*(?:(?:for|because)\s+|#\s*)(.+)$`)
+
+// karmaChange is one score change in a line.
+type karmaChange struct {
+	Target string
+	Delta  int
+	Reason string
+}
+
+// parseKarma finds the score changes in a line, in the order they were made. Changes in code spans or URLs don't
+// count, nor do one-letter targets (c++, i--) or changes stuck to other text. Each target counts once per line.
+func parseKarma(text string) []karmaChange {
+	// Blank out what's ignored, so that indices still match up with text.
+	clean := ignoredRe.ReplaceAllStringFunc(text, func(s string) string { return strings.Repeat(" ", len(s)) })
+
+	var changes []karmaChange
+	var ends []int // where each change ends, and so where its reason starts
+	var starts []int
+	seen := make(map[string]bool)
+	for _, m := range karmaRe.FindAllStringSubmatchIndex(clean, -1) {
+		start, end := m[0], m[1]
+		if start > 0 && !unicode.IsSpace(rune(clean[start-1])) {
+			continue
+		}
+		if end < len(clean) && !strings.ContainsRune(" \t,.:!?", rune(clean[end])) {
+			continue
+		}
+		target, op := "", ""
+		if m[2] >= 0 {
+			target, op = strings.Join(strings.Fields(clean[m[2]:m[3]]), " "), clean[m[4]:m[5]]
+		} else {
+			target, op = clean[m[6]:m[7]], clean[m[8]:m[9]]
+		}
+		if len([]rune(target)) < 2 || seen[strings.ToLower(target)] {
+			continue
+		}
+		seen[strings.ToLower(target)] = true
+
+		delta := 1
+		if op == "--" {
+			delta = -1
+		}
+		changes = append(changes, karmaChange{Target: target, Delta: delta})
+		starts = append(starts, start)
+		ends = append(ends, end)
+	}
+
+	for i := range changes {
+		next := len(text)
+		if i+1 < len(changes) {
+			next = starts[i+1]
+		}
+		if match := reasonRe.FindStringSubmatch(text[ends[i]:next]); match != nil {
+			changes[i].Reason = strings.TrimRight(match[1], " \t,;")
+		}
+	}
+	return changes
 }
 
-var scoreChangeRe = regexp.MustCompile("(\\w+)(\\+\\+|\\-\\-)")
 var myScoreRe = regexp.MustCompile("(\\w+), my score\\?")
 var scoreListRe = regexp.MustCompile("(\\w+), scores?\\?")
 var scoreMap = make(map[string]Score, 0)
 
-func (bot *IrcBot) scoreListener() (scorer Listener) {
-	scorer = func(msg irc.Message) (fired, trap bool) {
+// ScoreTrigger fires the score module. See Trigger.
+type ScoreTrigger struct{}
+
+func (t ScoreTrigger) Id() TriggerId {
+	return TriggerId("score")
+}
+
+func (t ScoreTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
+	return bot.fireModule("score", msg)
+}
+
+// scoreMetrics are the score module's own metrics.
+type scoreMetrics struct {
+	points *metrics.Counter // by direction
+	denied *metrics.Counter
+}
+
+func newScoreMetrics(m ModuleMetrics) scoreMetrics {
+	return scoreMetrics{
+		points: m.Counter("points_total", "Points given and taken away.", "direction"),
+		denied: m.Counter("denied_total", "Score changes which broke the rules."),
+	}
+}
+
+func (bot *IrcBot) scoreListener(_ *Network, m ModuleMetrics) (scorer Listener) {
+	sm := newScoreMetrics(m)
+	bot.persist("scores", &scoreMap)
+	bot.persist("karma", &karmaAdmin)
+	bot.HandleJobs("", "karma-recap", bot.recapJob)
+
+	pages := newPager()
+	scorer = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
 		if msg.Command != irc.Privmsg {
 			return
 		}
 
 		// TODO: clean this up
-		fired, trap = bot.handleScoreChange(msg)
+		fired, trap = bot.handleScoreChange(ctx, msg, sm)
 		if fired {
 			return
 		}
 
-		fired, trap = bot.handleScoreRequest(msg)
+		fired, trap = bot.handleLeaderboard(ctx, msg, pages)
 		if fired {
 			return
 		}
 
-		fired, trap = bot.handleMyScoreRequest(msg)
+		fired, trap = bot.handleScoreRequest(ctx, msg, pages)
+		if fired {
+			return
+		}
+
+		fired, trap = bot.handleMyScoreRequest(ctx, msg)
 		if fired {
 			return
 		}
@@ -69,78 +166,120 @@ func (bot *IrcBot) scoreListener() (scorer Listener) {
 	return
 }
 
-func (bot *IrcBot) handleScoreChange(msg irc.Message) (bool, bool) {
-	scoreChangeMatch := scoreChangeRe.FindStringSubmatch(msg.Text)
-	if len(scoreChangeMatch) == 0 {
+func (bot *IrcBot) handleScoreChange(ctx context.Context, msg irc.Message, sm scoreMetrics) (bool, bool) {
+	changes := parseKarma(msg.Text)
+	if len(changes) == 0 {
 		return false, false
 	}
-
-	nick := scoreChangeMatch[1]
-	_, ok := bot.namesSet[nick]
-
-	if !ok {
-		log.Println("Skipping because this isn't a nick for someone present:", nick)
+	// Scores are changed in front of everyone, under the channel's rules.
+	if !isChannel(msg.Channel) {
+		scoreLog.Debug("Ignoring score change in private", "network", msg.Network, "granter", msg.Nick)
 		return false, false
 	}
 
-	delta := -1
-	if scoreChangeMatch[2] == "++" {
-		delta = 1
-	}
+	n := bot.Network(msg.Network)
 	granter := msg.Nick
-	// TODO: make Reason interesting. If the originator only said foo++ then this is silly.
-	// Instead, we should use the SeenList in seen.go to gather what the person last said. If
-	// that person has no entry in the list, then omit a reason and just grant them the point.
-	reason := msg.Text
-	when := time.Now()
-	if seenInfo, ok := bot.seenList[granter]; ok {
-		reason = seenInfo.Message.Text
-		when = seenInfo.Timestamp
-	}
-	newPoint := Point{Granter: granter, When: when, Reason: reason}
-	newPoint.Increase = delta == 1
-	log.Printf("Looks like a score message for %v from %v.\n", nick, granter)
-
-	// TODO: user a pointer instead. Specifically, we should be able to get score out, modify it,
-	// and not have to reassign it at the end.
-	score := scoreMap[nick]
-	score.Total += delta
-	score.Points = append(score.Points, newPoint)
-	scoreMap[nick] = score
-
-	out := fmt.Sprintf("%v's score is now %d", nick, score.Total)
-	bot.Say(msg.Channel, out)
+	var out []string
+	for _, change := range changes {
+		nick := scoreKey(change.Target)
+		if len(nick) > maxThingLength {
+			scoreLog.Debug("Skipping score change for something too long to be a thing", "target", nick)
+			continue
+		}
+		if karmaAdmin.Blocked[strings.ToLower(nick)] {
+			n.Notice(ctx, granter, fmt.Sprintf("Sorry, %v's score is off limits.", nick))
+			continue
+		}
+		if denied := bot.karmaDenied(msg, nick, change.Delta); denied != "" {
+			scoreLog.Info("Denied score change", "nick", nick, "granter", granter, "why", denied)
+			sm.denied.Inc()
+			n.Notice(ctx, granter, denied)
+			continue
+		}
 
+		newPoint := Point{Granter: granter, When: bot.clock.Now(), Reason: change.Reason, Increase: change.Delta > 0,
+			Network: msg.Network}
+		scoreLog.Debug("Score change", "nick", nick, "granter", granter, "delta", change.Delta, "reason", change.Reason)
+
+		// TODO: user a pointer instead. Specifically, we should be able to get score out, modify it,
+		// and not have to reassign it at the end.
+		score := scoreMap[nick]
+		score.Total += change.Delta
+		score.Points = append(score.Points, newPoint)
+		score.Person = score.Person || n.isPresent(nick)
+		scoreMap[nick] = score
+		direction := "given"
+		if change.Delta < 0 {
+			direction = "taken"
+		}
+		sm.points.Inc(direction)
+		out = append(out, fmt.Sprintf("%v's score is now %d", nick, score.Total))
+	}
+	if len(out) == 0 {
+		return false, false
+	}
+
+	bot.Reply(ctx, msg, strings.Join(out, ", "))
 	return true, true
 }
 
-func (bot *IrcBot) handleScoreRequest(msg irc.Message) (fired, trap bool) {
-	scoreReqMatch := scoreListRe.FindStringSubmatch(msg.Text)
-	if len(scoreReqMatch) == 0 {
-		return
+// karmaDenied checks a score change against the channel's rules, and returns why it's not allowed, or "" if it is.
+func (bot *IrcBot) karmaDenied(msg irc.Message, target string, delta int) string {
+	network, channel, granter := msg.Network, msg.Channel, msg.Nick
+	n := bot.Network(network)
+	now := bot.clock.Now()
+
+	if delta > 0 && n.sameNick(target, granter) && !bot.settings.Bool(network, channel, "karma-self") {
+		return "Nice try, but you can't give yourself points."
 	}
 
-	if len(scoreMap) == 0 {
-		bot.Say(msg.Channel, "Nobody has a score yet!")
-		return true, true
+	if minTime := bot.settings.Duration(network, channel, "karma-min-time"); minTime > 0 {
+		// Anyone the bot hasn't seen in the channel might have only just got here.
+		if at, ok := n.arrivedAt(channel, granter); !n.inChannel(channel, granter) || ok && now.Sub(at) < minTime {
+			return fmt.Sprintf("You have to have been in %v for %v before you can change anyone's score. Not long now.",
+				channel, minTime)
+		}
 	}
 
-	for nick := range bot.namesSet {
-		out := fmt.Sprintf("%v has no score.", nick)
-		if score, ok := scoreMap[nick]; ok {
-			if nick == bot.irc.Nick() {
-				out = fmt.Sprintf("My score is %v.", score.Total)
-			} else {
-				out = fmt.Sprintf("%v's score is %v.", nick, score.Total)
+	cooldown := bot.settings.Duration(network, channel, "karma-cooldown")
+	dailyCap := bot.settings.Int(network, channel, "karma-daily-cap")
+	// Nicks are only unique on a network, so the same nick elsewhere is someone else.
+	var last time.Time
+	today := 0
+	for nick, score := range scoreMap {
+		for _, p := range score.Points {
+			if !n.sameNick(p.Granter, granter) || p.Network != network {
+				continue
+			}
+			if now.Sub(p.When) < 24*time.Hour {
+				today++
+			}
+			if nick == target && p.When.After(last) {
+				last = p.When
 			}
 		}
-		bot.Say(msg.Channel, out)
 	}
+	if wait := cooldown - now.Sub(last); wait > 0 {
+		return fmt.Sprintf("You only just changed %v's score. Try again in %v.", target, wait.Round(time.Second))
+	}
+	if dailyCap > 0 && today >= dailyCap {
+		return fmt.Sprintf("You've changed %d scores in the last day, which is as many as you can.", today)
+	}
+	return ""
+}
 
+// handleScoreRequest answers "scores?" with the top of the leaderboard.
+func (bot *IrcBot) handleScoreRequest(ctx context.Context, msg irc.Message, pages *pager) (fired, trap bool) {
+	scoreReqMatch := scoreListRe.FindStringSubmatch(msg.Text)
+	if len(scoreReqMatch) == 0 {
+		return
+	}
+
+	pages.say(ctx, bot, msg, boardLines("top", defaultBoardSize, everything, allTime))
 	return true, true
 }
 
-func (bot *IrcBot) handleMyScoreRequest(msg irc.Message) (fired, trap bool) {
+func (bot *IrcBot) handleMyScoreRequest(ctx context.Context, msg irc.Message) (fired, trap bool) {
 	myScoreMatch := myScoreRe.FindStringSubmatch(msg.Text)
 	if len(myScoreMatch) == 0 {
 		return
@@ -149,18 +288,22 @@ func (bot *IrcBot) handleMyScoreRequest(msg irc.Message) (fired, trap bool) {
 	out := []string{fmt.Sprintf("%v, you don't have a score yet.", msg.Nick)}
 	if score, ok := scoreMap[msg.Nick]; ok {
 		out = []string{fmt.Sprintf("%v, your score is %v.", msg.Nick, score.Total)}
+		f := bot.timeFormatFor(msg.Network, msg.Nick)
 		for _, point := range score.Points {
 			verb := "docked"
 			if point.Increase {
 				verb = "gave"
 			}
-			s := fmt.Sprintf("%v %v you a point at %v for saying \"%v\"", point.Granter, verb, point.When, point.Reason)
+			s := fmt.Sprintf("%v %v you a point %v", point.Granter, verb, f.ago(point.When))
+			if point.Reason != "" {
+				s += fmt.Sprintf(" for %v", point.Reason)
+			}
 			out = append(out, s)
 		}
 	}
 
 	for _, chat := range out {
-		bot.Say(msg.Channel, chat)
+		bot.Reply(ctx, msg, chat)
 	}
 
 	return true, true
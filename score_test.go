@@ -0,0 +1,355 @@
+package youandmeandirc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestHandleScoreChange(t *testing.T) {
+	ctx := context.Background()
+	bot, n, client := newTestBot(t)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	clock := irctest.NewClock(now)
+	bot.SetClock(clock)
+	sm := newScoreMetrics(bot.Metrics("score"))
+	n.addMember("#test", "bob", time.Time{})
+	n.addMember("#test", "carol", time.Time{})
+
+	fired, trap := bot.handleScoreChange(ctx, privmsg("alice", "bob++ for fixing the build"), sm)
+	if !fired || !trap {
+		t.Errorf("handleScoreChange(bob++) => %v, %v; want true, true", fired, trap)
+	}
+	clock.Advance(time.Minute)
+	bot.handleScoreChange(ctx, privmsg("alice", "bob-- golang++ carol++"), sm)
+	flush(n)
+
+	want := []string{"bob's score is now 1", "bob's score is now 0, golang's score is now 1, carol's score is now 1"}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said %q; want %q", got, want)
+	}
+
+	point := Point{Granter: "alice", When: now, Reason: "fixing the build", Increase: true, Network: "test"}
+	if got := scoreMap["bob"]; got.Total != 0 || len(got.Points) != 2 || got.Points[0] != point {
+		t.Errorf("bob's score => %+v; want a total of 0 and two points, the first %+v", got, point)
+	}
+	if !scoreMap["bob"].Person || scoreMap["golang"].Person {
+		t.Errorf("bob is a person => %v, golang => %v; want bob to be, since he's here, and golang not",
+			scoreMap["bob"].Person, scoreMap["golang"].Person)
+	}
+}
+
+func TestKarmaAdmin(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	bot.SetAdmins([]string{"alice"})
+	bot.settings.Set("test", "#test", "karma-cooldown", "0s")
+
+	for _, line := range []struct{ nick, text string }{
+		{"bob", "golang++ go++ Golang++"},
+		{"alice", "gobot, merge golang go"},
+		{"bob", "golang++"},
+		{"alice", "gobot, merge go go"},
+		{"alice", "gobot, block golang"},
+		{"bob", "golang++"},
+		{"alice", "gobot, unblock golang"},
+		{"alice", "gobot, block mondays"},
+		{"bob", "mondays--"},
+		{"alice", "gobot, unblock mondays"},
+		{"alice", "gobot, rename (the build) ci"},
+		{"bob", "(the build)++"},
+		{"alice", "gobot, rename (the build) ci"},
+		{"alice", "gobot, block ci"},
+		{"alice", "gobot, rename ci build"},
+		{"bob", "build++"},
+		{"alice", "gobot, unblock ci"},
+		{"alice", "gobot, unblock build"},
+		{"alice", "gobot, rename build ci"},
+		{"alice", "gobot, rename ci go"},
+		{"bob", "gobot, block go"},
+	} {
+		bot.runListeners(privmsg(line.nick, line.text))
+	}
+	flush(n)
+
+	want := []string{
+		"golang's score is now 1, go's score is now 1",
+		"OK, golang counts as go, who has 2 now.",
+		"go's score is now 3",
+		"That's the same thing.",
+		"OK, nobody can change go's score now.",
+		"OK, go's score can change again.",
+		"OK, nobody can change mondays's score now.",
+		"OK, mondays's score can change again.",
+		"the build doesn't have a score.",
+		"the build's score is now 1",
+		"OK, the build is now ci.",
+		"OK, nobody can change ci's score now.",
+		// The block goes with the score.
+		"OK, ci is now build.",
+		"ci isn't blocked.",
+		"OK, build's score can change again.",
+		"OK, build is now ci.",
+		"go already has a score. Merge them instead?",
+		"Sorry bob, only admins can do that.",
+	}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	wantNotices := []string{"go's score is off limits", "mondays's score is off limits", "build's score is off limits"}
+	if got := client.Noticed("bob"); len(got) != len(wantNotices) {
+		t.Errorf("notices to bob => %q; want ones saying %q", got, wantNotices)
+	} else {
+		for i, want := range wantNotices {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("notice %d to bob => %q; want one saying %q", i, got[i], want)
+			}
+		}
+	}
+	if _, ok := scoreMap["mondays"]; ok {
+		t.Errorf("mondays has a score, but it was blocked")
+	}
+	if got := scoreMap["go"]; got.Total != 3 || len(got.Points) != 3 {
+		t.Errorf("go's score => %+v; want 3, with golang's points", got)
+	}
+}
+
+// karmaLine is something said to the score module, a while after whatever was said before it.
+type karmaLine struct {
+	nick, text string
+	wait       time.Duration
+}
+
+func TestKarmaRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		lines    []karmaLine
+		scores   map[string]int
+		notices  map[string]int // how many notices each nick got
+	}{
+		{
+			name:    "self",
+			lines:   []karmaLine{{"alice", "alice++", 0}, {"alice", "alice--", 0}, {"ALICE", "(alice)++", 0}},
+			scores:  map[string]int{"alice": -1},
+			notices: map[string]int{"alice": 1, "ALICE": 1},
+		},
+		{
+			name:     "self allowed",
+			settings: map[string]string{"karma-self": "true"},
+			lines:    []karmaLine{{"alice", "alice++", 0}},
+			scores:   map[string]int{"alice": 1},
+		},
+		{
+			name:     "cooldown",
+			settings: map[string]string{"karma-cooldown": "10m"},
+			lines: []karmaLine{
+				{"alice", "bob++", 0},
+				{"alice", "bob++ carol++", 5 * time.Minute},
+				{"bob", "carol++", 0},
+				{"alice", "bob++", 5 * time.Minute},
+			},
+			scores:  map[string]int{"bob": 2, "carol": 2},
+			notices: map[string]int{"alice": 1},
+		},
+		{
+			name:     "daily cap",
+			settings: map[string]string{"karma-daily-cap": "2", "karma-cooldown": "0s"},
+			lines: []karmaLine{
+				{"alice", "bob++ carol++ dave++", 0},
+				{"alice", "carol--", time.Hour},
+				{"alice", "carol--", 23 * time.Hour},
+			},
+			scores:  map[string]int{"bob": 1, "carol": 0, "dave": 0},
+			notices: map[string]int{"alice": 2},
+		},
+		{
+			name:     "no cap",
+			settings: map[string]string{"karma-daily-cap": "0", "karma-cooldown": "0s"},
+			lines:    []karmaLine{{"alice", "bob++", 0}, {"alice", "bob++", 0}, {"alice", "bob++", 0}},
+			scores:   map[string]int{"bob": 3},
+		},
+		{
+			name:     "newcomers",
+			settings: map[string]string{"karma-min-time": "10m"},
+			lines: []karmaLine{
+				{"dave", "bob++", 5 * time.Minute},
+				{"alice", "bob++", 0},
+				{"dave", "bob++", 5 * time.Minute},
+			},
+			scores:  map[string]int{"bob": 2},
+			notices: map[string]int{"dave": 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bot, n, client := newTestBot(t)
+			clock := irctest.NewClock(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+			bot.SetClock(clock)
+			sm := newScoreMetrics(bot.Metrics("score"))
+			for key, value := range test.settings {
+				if err := bot.settings.Set("test", "#test", key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, nick := range []string{"alice", "bob", "carol"} {
+				n.addMember("#test", nick, time.Time{})
+			}
+			// dave's only just got here.
+			join := *irc.NewMessage(":dave!dave@test JOIN :#test")
+			join.Network = "test"
+			bot.runListeners(join)
+
+			for _, line := range test.lines {
+				clock.Advance(line.wait)
+				bot.handleScoreChange(context.Background(), privmsg(line.nick, line.text), sm)
+			}
+			flush(n)
+
+			for nick, want := range test.scores {
+				if got := scoreMap[nick].Total; got != want {
+					t.Errorf("%v's score => %d; want %d", nick, got, want)
+				}
+			}
+			for _, nick := range []string{"alice", "ALICE", "bob", "dave"} {
+				if got := client.Noticed(nick); len(got) != test.notices[nick] {
+					t.Errorf("notices to %v => %q; want %d", nick, got, test.notices[nick])
+				}
+			}
+		})
+	}
+}
+
+func TestKarmaRulesPerNetwork(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+	sm := newScoreMetrics(bot.Metrics("score"))
+	other := bot.AddNetwork("other", []string{"#test"}, nil)
+	otherClient := irctest.NewClient("gobot")
+	other.setClient(otherClient)
+	for _, network := range []string{"test", "other"} {
+		bot.settings.Set(network, "#test", "karma-cooldown", "10m")
+		bot.settings.Set(network, "#test", "karma-min-time", "10m")
+	}
+	run := func(network, line string) {
+		msg := *irc.NewMessage(line)
+		msg.Network = network
+		bot.runListeners(msg)
+	}
+	run("test", ":alice!alice@test JOIN :#test")
+	run("other", ":alice!alice@other JOIN :#test")
+	clock.Advance(time.Hour)
+
+	// The alice on the other network is someone else, with their own cooldown.
+	bot.handleScoreChange(context.Background(), privmsg("alice", "bob++"), sm)
+	fromOther := privmsg("alice", "bob++")
+	fromOther.Network = "other"
+	bot.handleScoreChange(context.Background(), fromOther, sm)
+	if got := scoreMap["bob"].Total; got != 2 {
+		t.Errorf("bob's score after alice++ on each network => %d; want 2", got)
+	}
+
+	// Leaving forgets when they arrived, so coming back makes them a newcomer again. A NAMES reply doesn't change that.
+	run("test", ":alice!alice@test PART #test")
+	run("test", ":alice!alice@test JOIN :#test")
+	run("test", ":irctest 353 gobot = #test :gobot alice")
+	clock.Advance(5 * time.Minute)
+	bot.handleScoreChange(context.Background(), privmsg("alice", "carol++"), sm)
+	flush(n)
+	flush(other)
+	if got := scoreMap["carol"].Total; got != 0 {
+		t.Errorf("carol's score after alice++ from a newcomer => %d; want 0", got)
+	}
+	if got := client.Noticed("alice"); len(got) != 1 {
+		t.Errorf("notices to alice on test => %q; want 1", got)
+	}
+	if got := otherClient.Noticed("alice"); len(got) != 0 {
+		t.Errorf("notices to alice on other => %q; want none", got)
+	}
+}
+
+func TestKarmaRulesLoopholes(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+	sm := newScoreMetrics(bot.Metrics("score"))
+	bot.settings.Set("test", "#test", "karma-cooldown", "10m")
+	bot.settings.Set("test", "#test", "karma-daily-cap", "2")
+	bot.settings.Set("test", "#test", "karma-min-time", "10m")
+	n.addMember("#test", "alice", time.Time{})
+
+	dm := *irc.NewMessage(":dave!dave@test PRIVMSG gobot :bob++")
+	dm.Network = "test"
+	for _, msg := range []irc.Message{
+		// Not in private, where the channel's rules don't apply.
+		dm,
+		// Not from someone the bot hasn't seen in the channel.
+		privmsg("dave", "bob++"),
+		// Nor by changing case to get round the cooldown, or the cap.
+		privmsg("alice", "bob++"),
+		privmsg("ALICE", "bob++"),
+		privmsg("Alice", "carol++"),
+		privmsg("aLiCe", "erin++"),
+	} {
+		bot.handleScoreChange(context.Background(), msg, sm)
+	}
+	flush(n)
+
+	for nick, want := range map[string]int{"bob": 1, "carol": 1, "erin": 0} {
+		if got := scoreMap[nick].Total; got != want {
+			t.Errorf("%v's score => %d; want %d", nick, got, want)
+		}
+	}
+	if got := client.Said("gobot"); len(got) != 0 {
+		t.Errorf("said to gobot %q; want nothing", got)
+	}
+	for nick, want := range map[string]int{"dave": 1, "ALICE": 1, "aLiCe": 1} {
+		if got := client.Noticed(nick); len(got) != want {
+			t.Errorf("notices to %v => %q; want %d", nick, got, want)
+		}
+	}
+}
+
+func TestParseKarma(t *testing.T) {
+	tests := []struct {
+		text string
+		want []karmaChange
+	}{
+		{"bob++", []karmaChange{{"bob", 1, ""}}},
+		{"bob--", []karmaChange{{"bob", -1, ""}}},
+		{"bob++ for fixing the build", []karmaChange{{"bob", 1, "fixing the build"}}},
+		{"bob++ because he fixed it", []karmaChange{{"bob", 1, "he fixed it"}}},
+		{"bob-- # broke the build", []karmaChange{{"bob", -1, "broke the build"}}},
+		{"bob++ #winning", []karmaChange{{"bob", 1, "winning"}}},
+		{"bob++ thanks", []karmaChange{{"bob", 1, ""}}},
+		{"(the build)++ for passing", []karmaChange{{"the build", 1, "passing"}}},
+		{"(  mondays  )--", []karmaChange{{"mondays", -1, ""}}},
+		{"alice++ for cake, bob++ for tea", []karmaChange{{"alice", 1, "cake"}, {"bob", 1, "tea"}}},
+		{"alice++ bob-- carol++", []karmaChange{{"alice", 1, ""}, {"bob", -1, ""}, {"carol", 1, ""}}},
+		{"bob++ bob++ bob++", []karmaChange{{"bob", 1, ""}}},
+		{"well done, bob++!", []karmaChange{{"bob", 1, ""}}},
+		{"[m]bob++", []karmaChange{{"[m]bob", 1, ""}}},
+
+		// Not karma.
+		{"I write c++ for a living", nil},
+		{"for (i = 0; i < n; i--)", nil},
+		{"x = count++;", nil},
+		{"use `total++` there", nil},
+		{"see https://example.com/a++ and www.example.com/b--", nil},
+		{"foo++bar", nil},
+		{"well--I don't know", nil},
+		{"-- signed, bob", nil},
+		{"++", nil},
+	}
+	for _, test := range tests {
+		if got := parseKarma(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseKarma(%q) => %+v; want %+v", test.text, got, test.want)
+		}
+	}
+}
@@ -1,95 +1,384 @@
 package youandmeandirc
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
 )
 
-type SeenInfo struct {
-	Message   irc.Message
-	Timestamp time.Time
+var seenLog = logging.Module("seen")
+
+// Activity is a kind of thing seen keeps track of people doing.
+type Activity string
+
+const (
+	Spoke       Activity = "spoke"
+	Joined      Activity = "joined"
+	Parted      Activity = "parted"
+	Quit        Activity = "quit"
+	RenamedTo   Activity = "renamed-to"   // Changed nick to Other.
+	RenamedFrom Activity = "renamed-from" // Changed nick from Other.
+	Kicked      Activity = "kicked"
+)
+
+// activities are all the kinds of Activity, in the order they're listed in.
+var activities = []Activity{Spoke, Joined, Parted, Quit, RenamedTo, RenamedFrom, Kicked}
+
+// Sighting is the last time someone did one kind of thing.
+type Sighting struct {
+	When    time.Time
+	Channel string `json:",omitempty"`
+	// Text is what they said, or why they left or were kicked.
+	Text string `json:",omitempty"`
+	// Other is the nick they changed to or from, or who kicked them.
+	Other string `json:",omitempty"`
 }
 
-type SeenTrigger struct {
-	SeenInfo map[string]SeenInfo
+// SeenInfo is the last time someone was seen doing each kind of thing on a network.
+type SeenInfo map[Activity]Sighting
+
+// UnmarshalJSON reads SeenInfo, or what was kept before there was more than one kind of activity: the last message of
+// any kind, and when it was.
+func (info *SeenInfo) UnmarshalJSON(b []byte) error {
+	var old struct {
+		Message   *irc.Message
+		Timestamp time.Time
+	}
+	if err := json.Unmarshal(b, &old); err == nil && old.Message != nil {
+		*info = make(SeenInfo)
+		s := Sighting{When: old.Timestamp, Channel: old.Message.Channel, Text: old.Message.Text}
+		switch old.Message.Command {
+		case irc.Privmsg:
+			(*info)[Spoke] = s
+		case irc.Join:
+			(*info)[Joined] = s
+		case irc.Part:
+			(*info)[Parted] = s
+		}
+		return nil
+	}
+	var m map[Activity]Sighting
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*info = m
+	return nil
 }
 
-func (t SeenTrigger) Id() TriggerId {
-	return TriggerId("seen")
+// latest returns the last thing someone was seen doing.
+func (info SeenInfo) latest() (a Activity, s Sighting) {
+	for _, kind := range activities {
+		if seen, ok := info[kind]; ok && (a == "" || seen.When.After(s.When)) {
+			a, s = kind, seen
+		}
+	}
+	return a, s
 }
 
-func (t SeenTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
-	fn := bot.seenListener()
-	fired, _ := fn(msg)
-	if fired {
-		return Fired
+// doing describes a sighting of activity a, as in "quitting (Ping timeout)".
+func doing(a Activity, s Sighting) string {
+	var out string
+	switch a {
+	case Spoke:
+		return fmt.Sprintf("saying %q in %v", s.Text, s.Channel)
+	case Joined:
+		return "joining " + s.Channel
+	case Parted:
+		out = "leaving " + s.Channel
+	case Quit:
+		out = "quitting"
+	case RenamedTo:
+		return "changing nick to " + s.Other
+	case RenamedFrom:
+		return "changing nick from " + s.Other
+	case Kicked:
+		out = fmt.Sprintf("being kicked from %v by %v", s.Channel, s.Other)
 	}
-	return Pass
+	if s.Text != "" {
+		out += fmt.Sprintf(" (%v)", s.Text)
+	}
+	return out
 }
 
-func (bot *IrcBot) seenListener() (seen Listener) {
-	bot.seenList = make(map[string]SeenInfo)
+// describeSeen answers "seen nick?": what they were last seen doing, and if that wasn't talking, what they last said.
+func describeSeen(nick string, info SeenInfo, f timeFormat) string {
+	a, s := info.latest()
+	if a == "" {
+		return fmt.Sprintf("Sorry, haven't seen %v.", nick)
+	}
+	out := fmt.Sprintf("%v was last seen %v %v", nick, f.ago(s.When), doing(a, s))
+	if said, ok := info[Spoke]; ok && a != Spoke {
+		out += fmt.Sprintf(", and last spoke %v in %v: %q", f.ago(said.When), said.Channel, said.Text)
+	}
+	return out + "."
+}
+
+// seenVerb says what someone did, briefly, for lists of who was seen: "alice quit 3 hours ago".
+func seenVerb(a Activity, s Sighting) string {
+	switch a {
+	case Spoke:
+		return "spoke in " + s.Channel
+	case Joined:
+		return "joined " + s.Channel
+	case Parted:
+		return "left " + s.Channel
+	case Quit:
+		return "quit"
+	case RenamedTo:
+		return "became " + s.Other
+	case RenamedFrom:
+		return "changed nick from " + s.Other
+	case Kicked:
+		return "was kicked from " + s.Channel
+	}
+	return string(a)
+}
 
-	seen = func(msg irc.Message) (fired, trap bool) {
-		accepted := []irc.Command{
-			irc.Privmsg,
-			irc.Join,
-			irc.Part,
+// maxListed is how many people seen lists in one answer before it gives up and says how many more there are.
+const maxListed = 10
+
+// findSeen looks nick up in n's seen table the way the server folds case, and returns the nick it's kept under.
+func findSeen(n *Network, nick string) (string, SeenInfo) {
+	if info, ok := n.seen[nick]; ok {
+		return nick, info
+	}
+	for name, info := range n.seen {
+		if n.sameNick(name, nick) {
+			return name, info
 		}
-		if !msg.Matches(accepted) {
-			return
+	}
+	return nick, nil
+}
+
+// globRe turns a nick pattern with * wildcards into a regexp that matches folded nicks.
+func globRe(n *Network, pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(n.fold(pattern))
+	return regexp.MustCompile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
+
+// seenMany answers "seen" about more than one nick, or a pattern, in a line or two: "alice quit 3 hours ago; bob
+// spoke in #test just now; haven't seen carol."
+func seenMany(n *Network, queries []string, f timeFormat) []string {
+	type found struct {
+		nick string
+		a    Activity
+		s    Sighting
+	}
+	var items, missing []string
+	for _, q := range queries {
+		var matches []found
+		if strings.Contains(q, "*") {
+			re := globRe(n, q)
+			for nick, info := range n.seen {
+				if re.MatchString(n.fold(nick)) {
+					a, s := info.latest()
+					matches = append(matches, found{nick, a, s})
+				}
+			}
+			sort.Slice(matches, func(i, j int) bool { return matches[i].s.When.After(matches[j].s.When) })
+		} else if nick, info := findSeen(n, q); info != nil {
+			a, s := info.latest()
+			matches = append(matches, found{nick, a, s})
 		}
+		if len(matches) == 0 {
+			missing = append(missing, q)
+			continue
+		}
+		for i, m := range matches {
+			if i == maxListed {
+				items = append(items, fmt.Sprintf("%d more matching %v", len(matches)-maxListed, q))
+				break
+			}
+			items = append(items, fmt.Sprintf("%v %v %v", m.nick, seenVerb(m.a, m.s), f.ago(m.s.When)))
+		}
+	}
+	if len(missing) > 0 {
+		items = append(items, "haven't seen "+strings.Join(missing, " or "))
+	}
+	lines := pack("", items, "; ")
+	lines[len(lines)-1] += "."
+	return lines
+}
 
-		re := regexp.MustCompile(fmt.Sprintf("%v, seen (\\w+)\\?", bot.irc.Nick))
+// parseSpan parses how far back active and lurkers look, as a duration like 90m, or a number of days, as in 2d.
+func parseSpan(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
 
-		fired = true
-		match := re.FindStringSubmatch(msg.Text)
-		if len(match) == 0 {
-			info := SeenInfo{msg, time.Now()}
-			bot.seenList[msg.Nick] = info
-			log.Printf("Storing message from %v: %v\n", msg.Nick, info)
-			return
+// listed joins up to maxListed names, saying how many more there are: "alice, bob and 3 others".
+func listed(names []string) string {
+	if len(names) > maxListed {
+		return fmt.Sprintf("%v and %d others", strings.Join(names[:maxListed], ", "), len(names)-maxListed)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// active answers who has said something in channel within d, most recent first.
+func active(n *Network, channel string, d time.Duration, f timeFormat) string {
+	type speaker struct {
+		nick string
+		when time.Time
+	}
+	var speakers []speaker
+	for nick, when := range n.spoke[n.fold(channel)] {
+		if f.now.Sub(when) <= d {
+			speakers = append(speakers, speaker{nick, when})
 		}
+	}
+	if len(speakers) == 0 {
+		return fmt.Sprintf("Nobody's said anything in %v in the last %v.", channel, shortDuration(d))
+	}
+	sort.Slice(speakers, func(i, j int) bool { return speakers[i].when.After(speakers[j].when) })
+	var names []string
+	for _, s := range speakers {
+		names = append(names, fmt.Sprintf("%v (%v)", s.nick, f.ago(s.when)))
+	}
+	return fmt.Sprintf("Active in %v in the last %v: %v.", channel, shortDuration(d), listed(names))
+}
 
-		who := match[1]
-		out := fmt.Sprintf("Sorry, haven't seen %v.", who)
-		prev, ok := bot.seenList[who]
-		if ok {
-			out = fmt.Sprintf("I last saw %v at %v, saying \"%v\".", who, prev.Timestamp, prev.Message.Text)
+// lurkers answers who's in channel but hasn't said anything there, ever or, if d isn't zero, within d.
+func lurkers(n *Network, channel string, d time.Duration, now time.Time) string {
+	var names []string
+	for _, nick := range n.Members(channel) {
+		if n.sameNick(nick, n.Nick()) {
+			continue
+		}
+		when, ok := n.spoke[n.fold(channel)][nick]
+		if !ok || d > 0 && now.Sub(when) > d {
+			names = append(names, nick)
 		}
-		bot.Say(msg.Channel, out)
-		trap = true
-		return
 	}
+	quiet := ""
+	if d > 0 {
+		quiet = fmt.Sprintf(", quiet for the last %v", shortDuration(d))
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("Nobody's lurking in %v%v.", channel, quiet)
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return fmt.Sprintf("Lurking in %v%v: %v.", channel, quiet, listed(names))
+}
 
-	return
+// isChannel reports whether target is a channel, rather than someone's nick.
+func isChannel(target string) bool {
+	return strings.HasPrefix(target, "#") || strings.HasPrefix(target, "&")
 }
 
-/// New implementation.
+// seenRe matches the questions seen answers: "gobot, seen alice?", "gobot, seen al* bob", "gobot, active 2h" and
+// "gobot, lurkers".
+var seenRe = regexp.MustCompile(`^(\S+)[,:] (seen|active|lurkers)(?: +([^?]*?))? *\??$`)
 
-// SeenModule encompasses the Seen lookup, a table containing when IRC nicks were last seen and what they were saying.
-type SeenModule struct {
-	SeenMap map[string]SeenInfo
+// SeenTrigger fires the seen module. See Trigger.
+type SeenTrigger struct {
+	// SeenInfo isn't used: seen keeps track of each network separately.
+	SeenInfo map[string]SeenInfo
 }
 
-// Initializes SeenModule.
-func (sm *SeenModule) init() {
-	sm.SeenMap = make(map[string]SeenInfo)
+func (t SeenTrigger) Id() TriggerId {
+	return TriggerId("seen")
 }
 
-func (sm *SeenModule) accepts() []irc.Command {
-	return []irc.Command{
-		irc.Privmsg,
-		irc.Join,
-		irc.Part,
-	}
+func (t SeenTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
+	return bot.fireModule("seen", msg)
 }
 
-// func SeenListener(bot *IrcBot, msg IrcMessage) (trap bool)
+func (bot *IrcBot) seenListener(n *Network) (seen Listener) {
+	n.seen = make(map[string]SeenInfo)
+	bot.persist("seen-"+n.Name, &n.seen)
+
+	see := func(nick string, a Activity, s Sighting) {
+		nick, info := findSeen(n, nick)
+		if info == nil {
+			info = make(SeenInfo)
+			n.seen[nick] = info
+		}
+		info[a] = s
+		seenLog.Debug("Storing sighting", "network", n.Name, "nick", nick, "activity", a)
+	}
+
+	// answer replies to a question seenRe matched, and reports whether it made sense.
+	answer := func(ctx context.Context, msg irc.Message, cmd string, args []string) bool {
+		f := bot.timeFormatFor(n.Name, msg.Nick)
+		switch {
+		case cmd == "seen" && len(args) == 1 && !strings.Contains(args[0], "*"):
+			_, info := findSeen(n, args[0])
+			bot.Reply(ctx, msg, describeSeen(args[0], info, f))
+		case cmd == "seen" && len(args) > 0:
+			for _, line := range seenMany(n, args, f) {
+				bot.Reply(ctx, msg, line)
+			}
+		case cmd == "active" && len(args) <= 1 && isChannel(msg.Channel):
+			d := time.Hour
+			if len(args) == 1 {
+				var ok bool
+				if d, ok = parseSpan(args[0]); !ok {
+					return false
+				}
+			}
+			bot.Reply(ctx, msg, active(n, msg.Channel, d, f))
+		case cmd == "lurkers" && len(args) <= 1 && isChannel(msg.Channel):
+			var d time.Duration
+			if len(args) == 1 {
+				var ok bool
+				if d, ok = parseSpan(args[0]); !ok {
+					return false
+				}
+			}
+			bot.Reply(ctx, msg, lurkers(n, msg.Channel, d, f.now))
+		default:
+			return false
+		}
+		return true
+	}
 
-// // Public API.
-// func (seenMod *SeenModule) HasSeen(nick string) *SeenInfo
+	seen = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+		now := bot.clock.Now()
+		switch msg.Command {
+		case irc.Privmsg:
+			if match := seenRe.FindStringSubmatch(msg.Text); match != nil && n.sameNick(match[1], n.Nick()) {
+				if answer(ctx, msg, match[2], strings.Fields(match[3])) {
+					return true, true
+				}
+			}
+			// What people say to the bot in private stays private.
+			if isChannel(msg.Channel) {
+				see(msg.Nick, Spoke, Sighting{When: now, Channel: msg.Channel, Text: msg.Text})
+			}
+		case irc.Join:
+			see(msg.Nick, Joined, Sighting{When: now, Channel: msg.Channel})
+		case irc.Part:
+			see(msg.Nick, Parted, Sighting{When: now, Channel: msg.Channel, Text: msg.Text})
+		case irc.Quit:
+			see(msg.Nick, Quit, Sighting{When: now, Text: msg.Text})
+		case irc.Nick:
+			see(msg.Nick, RenamedTo, Sighting{When: now, Other: msg.Text})
+			see(msg.Text, RenamedFrom, Sighting{When: now, Other: msg.Nick})
+		case irc.Kick:
+			if len(msg.Args) == 0 {
+				return
+			}
+			see(msg.Args[0], Kicked, Sighting{When: now, Channel: msg.Channel, Text: msg.Text, Other: msg.Nick})
+		default:
+			return
+		}
+		return true, false
+	}
+
+	return
+}
@@ -0,0 +1,158 @@
+package youandmeandirc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestSeenActivities(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		lines []string // From the server, an hour apart.
+		nick  string
+		want  string
+	}{
+		{
+			lines: []string{":alice!alice@test JOIN #test"},
+			nick:  "alice",
+			want:  "alice was last seen an hour ago joining #test.",
+		},
+		{
+			lines: []string{
+				":alice!alice@test PRIVMSG #test :anyone around?",
+				":alice!alice@test PART #test :lunch",
+			},
+			nick: "alice",
+			want: `alice was last seen an hour ago leaving #test (lunch), and last spoke 2 hours ago in #test: "anyone around?".`,
+		},
+		{
+			lines: []string{":alice!alice@test PART #test"},
+			nick:  "alice",
+			want:  "alice was last seen an hour ago leaving #test.",
+		},
+		{
+			lines: []string{":alice!alice@test NICK :alice|away"},
+			nick:  "alice",
+			want:  "alice was last seen an hour ago changing nick to alice|away.",
+		},
+		{
+			lines: []string{":alice!alice@test NICK :alice|away"},
+			nick:  "alice|away",
+			want:  "alice|away was last seen an hour ago changing nick from alice.",
+		},
+		{
+			lines: []string{
+				":bob!bob@test PRIVMSG #test :buy now",
+				":alice!alice@test KICK #test bob :spam",
+			},
+			nick: "bob",
+			want: `bob was last seen an hour ago being kicked from #test by alice (spam), and last spoke 2 hours ago in #test: "buy now".`,
+		},
+		{
+			// Private messages stay private.
+			lines: []string{":alice!alice@test PRIVMSG gobot :my password is hunter2"},
+			nick:  "alice",
+			want:  "Sorry, haven't seen alice.",
+		},
+	}
+
+	for _, test := range tests {
+		bot, n, _ := newTestBot(t)
+		clock := irctest.NewClock(start)
+		bot.SetClock(clock)
+		for _, line := range test.lines {
+			msg := *irc.NewMessage(line)
+			msg.Network = "test"
+			bot.runListeners(msg)
+			clock.Advance(time.Hour)
+		}
+		if got := describeSeen(test.nick, n.seen[test.nick], bot.timeFormatFor("test", "bob")); got != test.want {
+			t.Errorf("after %q, seen %v => %q; want %q", test.lines, test.nick, got, test.want)
+		}
+	}
+}
+
+func TestSeenInfoUnmarshalOld(t *testing.T) {
+	when := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	old := map[string]interface{}{
+		"Message":   irc.Message{Command: irc.Privmsg, Channel: "#test", Text: "hello", Nick: "alice"},
+		"Timestamp": when,
+	}
+	b, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SeenInfo
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := SeenInfo{Spoke: {When: when, Channel: "#test", Text: "hello"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unmarshalling %s => %+v; want %+v", b, got, want)
+	}
+}
+
+func TestSeenQueries(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+
+	for _, line := range []string{
+		":irctest 005 gobot CHANTYPES=# CASEMAPPING=rfc1459 :are supported by this server",
+		":irctest 353 gobot = #test :gobot @alice +[bob] carol` dave_ erin|away",
+		":alice!alice@test PRIVMSG #test :morning",
+		":[bob]!bob@test PRIVMSG #test :hi",
+		":carol`!carol@test PRIVMSG #other :anyone?",
+		":erin|away!erin@test JOIN #test",
+		":alice!alice@test PRIVMSG #test :still here",
+	} {
+		msg := *irc.NewMessage(line)
+		msg.Network = "test"
+		bot.runListeners(msg)
+		clock.Advance(30 * time.Minute)
+	}
+
+	tests := []struct {
+		ask  string
+		want string
+	}{
+		{"gobot, seen {BOB}?", `{BOB} was last seen 2 hours ago saying "hi" in #test.`},
+		{"gobot, seen carol`", `carol` + "`" + ` was last seen an hour ago saying "anyone?" in #other.`},
+		{"gobot, seen erin|AWAY?", "erin|AWAY was last seen an hour ago joining #test."},
+		{"gobot, seen alice [BOB] zed?", "alice spoke in #test 30 minutes ago; [bob] spoke in #test 2 hours ago; haven't seen zed."},
+		{"gobot, seen *R*", "erin|away joined #test an hour ago; carol` spoke in #other an hour ago."},
+		{"gobot, seen zed* yves", "haven't seen zed* or yves."},
+		// Asking counts as saying something.
+		{"gobot, active", "Active in #test in the last 1h: zed (just now) and alice (30 minutes ago)."},
+		{"gobot, active 3h", "Active in #test in the last 3h: zed (just now), alice (30 minutes ago) and [bob] (2 hours ago)."},
+		{"gobot, active 1m", "Active in #test in the last 1m: zed (just now)."},
+		{"gobot, lurkers", "Lurking in #test: carol`, dave_ and erin|away."},
+		{"gobot, lurkers 1h", "Lurking in #test, quiet for the last 1h: [bob], carol`, dave_ and erin|away."},
+	}
+	for _, test := range tests {
+		client.Reset()
+		bot.runListeners(privmsg("zed", test.ask))
+		flush(n)
+		if got := client.Said("#test"); len(got) != 1 || got[0] != test.want {
+			t.Errorf("%q => %q; want %q", test.ask, got, test.want)
+		}
+	}
+
+	// Lines other modules trap still count, such as giving points.
+	clock.Advance(time.Hour)
+	bot.runListeners(privmsg("dave_", "golang++"))
+	flush(n)
+	client.Reset()
+	clock.Advance(time.Second)
+	bot.runListeners(privmsg("alice", "gobot, active 1m"))
+	flush(n)
+	want := "Active in #test in the last 1m: alice (just now) and dave_ (just now)."
+	if got := client.Said("#test"); len(got) != 1 || got[0] != want {
+		t.Errorf("active after dave_'s golang++ => %q; want %q", got, want)
+	}
+}
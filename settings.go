@@ -0,0 +1,243 @@
+package youandmeandirc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type settingKind int
+
+const (
+	durationSetting settingKind = iota
+	intSetting
+	// limitSetting is a whole number where 0 means no limit.
+	limitSetting
+	boolSetting
+)
+
+type settingDef struct {
+	kind settingKind
+	def  string
+}
+
+// settingDefs lists every setting that can be overridden per channel, along with its default.
+var settingDefs = map[string]settingDef{
+	// How long the bot pretends to spend typing each character of a reply.
+	"typing-delay": {durationSetting, "10ms"},
+	// How long the bot stays asleep after being told to hush.
+	"sleep-time": {durationSetting, "5m"},
+	// How much health everyone starts combat with.
+	"combat-hp": {intSetting, "10"},
+	// Whether people can give themselves points.
+	"karma-self": {boolSetting, "false"},
+	// How long someone has to wait before changing the same person's score again.
+	"karma-cooldown": {durationSetting, "1m"},
+	// How many points someone can give or take away in a day.
+	"karma-daily-cap": {limitSetting, "20"},
+	// How long it takes a point to be worth half as much, for "top decayed". 0 means points don't decay.
+	"karma-half-life": {durationSetting, "720h"},
+	// How long someone has to have been in the channel before they can change scores. Anyone who was there before
+	// the bot counts as having been there long enough.
+	"karma-min-time": {durationSetting, "0s"},
+}
+
+// validateSetting returns an error unless key is a known setting and value makes sense for it.
+func validateSetting(key, value string) error {
+	def, ok := settingDefs[key]
+	if !ok {
+		return fmt.Errorf("no such setting %q", key)
+	}
+
+	switch def.kind {
+	case durationSetting:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%v wants a duration like 10ms or 5m", key)
+		}
+		if d < 0 {
+			return fmt.Errorf("%v can't be negative", key)
+		}
+	case intSetting:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%v wants a whole number", key)
+		}
+		if i <= 0 {
+			return fmt.Errorf("%v has to be more than zero", key)
+		}
+	case limitSetting:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%v wants a whole number, or 0 for no limit", key)
+		}
+		if i < 0 {
+			return fmt.Errorf("%v can't be negative", key)
+		}
+	case boolSetting:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%v wants true or false", key)
+		}
+	}
+	return nil
+}
+
+// ChannelSettings are the overrides for a single channel.
+type ChannelSettings struct {
+	// Disabled modules don't hear anything said in the channel.
+	Disabled map[string]bool
+	// Values overrides settings by name.
+	Values map[string]string
+}
+
+// Settings holds every channel's overrides. Channels without overrides get the defaults from settingDefs, with all
+// modules enabled. It's safe to use from any goroutine, so async modules can read settings while admin commands
+// change them.
+type Settings struct {
+	mu       sync.RWMutex // guards channels, and everything in it
+	channels map[string]*ChannelSettings
+}
+
+func NewSettings() *Settings {
+	return &Settings{channels: make(map[string]*ChannelSettings)}
+}
+
+// settingsKey identifies a channel on a network. Channel names are case-insensitive.
+func settingsKey(network, channel string) string {
+	return network + " " + strings.ToLower(channel)
+}
+
+// lookup returns a channel's overrides, or nil if it has none. s.mu must be held.
+func (s *Settings) lookup(network, channel string) *ChannelSettings {
+	return s.channels[settingsKey(network, channel)]
+}
+
+// Channel returns the overrides for a channel, creating them if need be. They mustn't be changed directly once the
+// bot has started; use SetEnabled, Set and Unset, which lock.
+func (s *Settings) Channel(network, channel string) *ChannelSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channel(network, channel)
+}
+
+// channel is Channel, with s.mu already held.
+func (s *Settings) channel(network, channel string) *ChannelSettings {
+	key := settingsKey(network, channel)
+	cs, ok := s.channels[key]
+	if !ok {
+		cs = &ChannelSettings{
+			Disabled: make(map[string]bool),
+			Values:   make(map[string]string),
+		}
+		s.channels[key] = cs
+	}
+	return cs
+}
+
+// replace swaps in other's overrides for s's, as when the config is reloaded. other mustn't be used afterwards.
+func (s *Settings) replace(other *Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels = other.channels
+}
+
+// Enabled reports whether module should hear messages in a channel.
+func (s *Settings) Enabled(network, channel, module string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cs := s.lookup(network, channel)
+	return cs == nil || !cs.Disabled[module]
+}
+
+func (s *Settings) SetEnabled(network, channel, module string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cs := s.channel(network, channel)
+	if enabled {
+		delete(cs.Disabled, module)
+	} else {
+		cs.Disabled[module] = true
+	}
+}
+
+// Set overrides a setting in a channel, if value is valid for it.
+func (s *Settings) Set(network, channel, key, value string) error {
+	if err := validateSetting(key, value); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channel(network, channel).Values[key] = value
+	return nil
+}
+
+// Unset reverts a channel to the default for a setting.
+func (s *Settings) Unset(network, channel, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cs := s.lookup(network, channel); cs != nil {
+		delete(cs.Values, key)
+	}
+}
+
+// Get returns the value of a setting in a channel, falling back to its default.
+func (s *Settings) Get(network, channel, key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if cs := s.lookup(network, channel); cs != nil {
+		if v, ok := cs.Values[key]; ok {
+			return v
+		}
+	}
+	return settingDefs[key].def
+}
+
+// Duration returns a duration setting. Values are validated on the way in, so errors aren't expected here.
+func (s *Settings) Duration(network, channel, key string) time.Duration {
+	d, _ := time.ParseDuration(s.Get(network, channel, key))
+	return d
+}
+
+// Int returns a numeric setting.
+func (s *Settings) Int(network, channel, key string) int {
+	i, _ := strconv.Atoi(s.Get(network, channel, key))
+	return i
+}
+
+// Bool returns a true or false setting.
+func (s *Settings) Bool(network, channel, key string) bool {
+	b, _ := strconv.ParseBool(s.Get(network, channel, key))
+	return b
+}
+
+// Describe summarizes a channel's overrides, e.g. "disabled: combat; combat-hp=20".
+func (s *Settings) Describe(network, channel string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cs := s.lookup(network, channel)
+	if cs == nil || len(cs.Disabled) == 0 && len(cs.Values) == 0 {
+		return "all defaults"
+	}
+
+	var parts []string
+	if len(cs.Disabled) > 0 {
+		var disabled []string
+		for m := range cs.Disabled {
+			disabled = append(disabled, m)
+		}
+		sort.Strings(disabled)
+		parts = append(parts, "disabled: "+strings.Join(disabled, ", "))
+	}
+
+	var values []string
+	for k, v := range cs.Values {
+		values = append(values, k+"="+v)
+	}
+	sort.Strings(values)
+	parts = append(parts, values...)
+
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,71 @@
+package youandmeandirc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettings(t *testing.T) {
+	s := NewSettings()
+
+	if got := s.Duration("net", "#chan", "sleep-time"); got != 5*time.Minute {
+		t.Errorf("default sleep-time => %v; want 5m", got)
+	}
+
+	if err := s.Set("net", "#Chan", "combat-hp", "20"); err != nil {
+		t.Fatalf("Set(combat-hp, 20) => %v", err)
+	}
+	if got := s.Int("net", "#chan", "combat-hp"); got != 20 {
+		t.Errorf("combat-hp in #chan => %v; want 20", got)
+	}
+	if got := s.Int("net", "#other", "combat-hp"); got != 10 {
+		t.Errorf("combat-hp in #other => %v; want the default of 10", got)
+	}
+	if got := s.Int("othernet", "#chan", "combat-hp"); got != 10 {
+		t.Errorf("combat-hp in #chan on othernet => %v; want the default of 10", got)
+	}
+
+	s.Unset("net", "#chan", "combat-hp")
+	if got := s.Int("net", "#chan", "combat-hp"); got != 10 {
+		t.Errorf("combat-hp after Unset => %v; want 10", got)
+	}
+
+	s.SetEnabled("net", "#chan", "combat", false)
+	if s.Enabled("net", "#chan", "combat") {
+		t.Errorf("combat is still enabled in #chan after disabling it")
+	}
+	if !s.Enabled("net", "#other", "combat") {
+		t.Errorf("disabling combat in #chan disabled it in #other too")
+	}
+	s.SetEnabled("net", "#chan", "combat", true)
+	if !s.Enabled("net", "#chan", "combat") {
+		t.Errorf("combat is still disabled in #chan after enabling it")
+	}
+}
+
+func TestValidateSetting(t *testing.T) {
+	tests := []struct {
+		key, value string
+		ok         bool
+	}{
+		{"typing-delay", "5ms", true},
+		{"typing-delay", "0s", true},
+		{"typing-delay", "fast", false},
+		{"typing-delay", "-1s", false},
+		{"combat-hp", "50", true},
+		{"combat-hp", "0", false},
+		{"combat-hp", "lots", false},
+		{"karma-daily-cap", "0", true},
+		{"karma-daily-cap", "-1", false},
+		{"karma-self", "true", true},
+		{"karma-self", "sometimes", false},
+		{"no-such-thing", "1", false},
+	}
+
+	for _, test := range tests {
+		err := validateSetting(test.key, test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("validateSetting(%q, %q) => %v; want ok=%v", test.key, test.value, err, test.ok)
+		}
+	}
+}
@@ -1,57 +1,70 @@
 package youandmeandirc
 
 import (
-	// "fmt"
-	"log"
+	"context"
 	"time"
 
 	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
 )
 
+var sleepLog = logging.Module("sleep")
+
+// SleepTrigger fires the sleep module. See Trigger.
 type SleepTrigger struct{}
 
 func (t SleepTrigger) Id() TriggerId {
-	return TriggerId("combat")
+	return TriggerId("sleep")
 }
 
 func (t SleepTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
-	fn := bot.sleepListener()
-	fired, _ := fn(msg)
-	if fired {
-		return Fired
-	}
-	return Pass
+	return bot.fireModule("sleep", msg)
 }
 
-func (bot *IrcBot) sleepListener() (sleep Listener) {
-	sleepMinutes := time.Duration(5) * time.Minute
-	var sleptAt time.Time
+func (bot *IrcBot) sleepListener(n *Network) (sleep Listener) {
+	// When the bot went to sleep in each channel it's asleep in, and the job which wakes it up.
+	sleptAt := make(map[string]time.Time)
+	wakeJobs := make(map[string]int)
 
-	sleep = func(msg irc.Message) (fired, trap bool) {
+	wake := func(ctx context.Context, channel, text string) {
+		n.Say(ctx, channel, text)
+		channel = n.fold(channel)
+		delete(sleptAt, channel)
+		bot.Cancel(wakeJobs[channel])
+		delete(wakeJobs, channel)
+	}
+	// The wake-up job runs even if nobody says anything. After a restart, the bot's awake anyway, so it keeps quiet.
+	bot.HandleJobs(n.Name, "wake", func(ctx context.Context, job Job) {
+		if id, ok := wakeJobs[n.fold(job.Target)]; ok && id == job.ID {
+			wake(ctx, job.Target, "Zzz— what? How long was I out?")
+		}
+	})
+
+	sleep = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
 		if msg.Command != irc.Privmsg {
 			return
 		}
 
-		if bot.asleep {
-			if msg.TextHas("wake up") && msg.TextHas(bot.irc.Nick()) {
+		channel := n.fold(msg.Channel)
+		if at, asleep := sleptAt[channel]; asleep {
+			if msg.TextHas("wake up") && msg.TextHas(n.Nick()) {
 				// wake up
-				bot.asleep = false
-				bot.irc.Say(msg.Channel, "I'm awake! I'm awake!")
+				wake(ctx, msg.Channel, "I'm awake! I'm awake!")
 			} else {
-				since := time.Since(sleptAt)
+				sleepMinutes := bot.settings.Duration(msg.Network, msg.Channel, "sleep-time")
+				since := bot.clock.Since(at)
 				if since.Minutes() > sleepMinutes.Minutes() {
-					// unsleep!
-					bot.irc.Say(msg.Channel, "Zzz— what? How long was I out?")
-					bot.asleep = false
+					// unsleep! The job should have done this already, but it only looks every so often.
+					wake(ctx, msg.Channel, "Zzz— what? How long was I out?")
 				} else {
-					log.Printf("Zzzz. Still sleeping. %v minutes to go.\n", sleepMinutes.Minutes()-since.Minutes())
+					sleepLog.Debug("Still sleeping", "channel", msg.Channel, "left", sleepMinutes-since)
 				}
 			}
 
 			return true, true
 		}
 
-		if msg.Command != irc.Privmsg || !msg.TextHas(bot.irc.Nick()) {
+		if msg.Command != irc.Privmsg || !msg.TextHas(n.Nick()) {
 			return
 		}
 
@@ -67,10 +80,20 @@ func (bot *IrcBot) sleepListener() (sleep Listener) {
 			return
 		}
 
-		// We've been told to sleep.
-		bot.asleep = true
-		bot.irc.Say(msg.Channel, "OK, I'll go to sleep. Good night.")
-		sleptAt = time.Now()
+		// We've been told to sleep, but only here.
+		n.Say(ctx, msg.Channel, "OK, I'll go to sleep. Good night.")
+		sleptAt[channel] = bot.clock.Now()
+		id, err := bot.Schedule(Job{
+			Kind:    "wake",
+			Network: n.Name,
+			Target:  msg.Channel,
+			At:      sleptAt[channel].Add(bot.settings.Duration(msg.Network, msg.Channel, "sleep-time")),
+		})
+		if err != nil {
+			sleepLog.Error("Unable to schedule waking up", "channel", msg.Channel, "err", err)
+			return true, true
+		}
+		wakeJobs[channel] = id
 		return true, true
 	}
 	return
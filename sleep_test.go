@@ -0,0 +1,78 @@
+package youandmeandirc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestSleepWakesUpOnItsOwn(t *testing.T) {
+	ctx := context.Background()
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+	sleep := bot.sleepListener(n)
+
+	sleep(ctx, privmsg("alice", "gobot, hush"))
+	clock.Advance(4 * time.Minute)
+	if _, trap := sleep(ctx, privmsg("alice", "anyone here?")); !trap {
+		t.Errorf("the bot was awake after 4 minutes; want it asleep for 5")
+	}
+	clock.Advance(2 * time.Minute)
+	sleep(ctx, privmsg("alice", "anyone here?"))
+	if _, trap := sleep(ctx, privmsg("alice", "how about now?")); trap {
+		t.Errorf("the bot was still asleep after 6 minutes")
+	}
+	flush(n)
+
+	// That's a non-breaking space after the dash.
+	want := []string{"OK, I'll go to sleep. Good night.", "Zzz—\u00a0what? How long was I out?"}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said %q; want %q", got, want)
+	}
+}
+
+func TestSleepFoldsChannels(t *testing.T) {
+	ctx := context.Background()
+	bot, n, _ := newTestBot(t)
+	sleep := bot.sleepListener(n)
+
+	hush := privmsg("alice", "gobot, hush")
+	hush.Channel = "#foo["
+	sleep(ctx, hush)
+	// Under rfc1459 casemapping, which servers assume unless they say otherwise, that's the same channel.
+	msg := privmsg("alice", "anyone here?")
+	msg.Channel = "#FOO{"
+	if _, trap := sleep(ctx, msg); !trap {
+		t.Errorf("the bot was awake in %v after being told to hush in %v", msg.Channel, hush.Channel)
+	}
+}
+
+func TestSleepWakesUpOnTime(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+
+	bot.runListeners(privmsg("alice", "gobot, hush"))
+	clock.Advance(5 * time.Minute)
+	bot.runDueJobs()
+	flush(n)
+
+	want := []string{"OK, I'll go to sleep. Good night.", "Zzz—\u00a0what? How long was I out?"}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said %q without anyone else speaking; want %q", got, want)
+	}
+	if jobs := bot.Jobs(nil); len(jobs) != 0 {
+		t.Errorf("jobs left => %+v; want none", jobs)
+	}
+
+	// Being woken up early cancels the job.
+	bot.runListeners(privmsg("alice", "gobot, hush"))
+	bot.runListeners(privmsg("alice", "gobot, wake up"))
+	if jobs := bot.Jobs(nil); len(jobs) != 0 {
+		t.Errorf("jobs left after waking up early => %+v; want none", jobs)
+	}
+}
@@ -0,0 +1,322 @@
+package youandmeandirc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var statusLog = logging.Subsystem("status")
+
+// NetworkStatus is how a network's connection is doing.
+type NetworkStatus struct {
+	Name      string `json:"name"`
+	Nick      string `json:"nick"`
+	Connected bool   `json:"connected"`
+	Joined    bool   `json:"joined"`
+	Uptime    string `json:"uptime"` // e.g. "3h2m1s"
+	Lag       string `json:"lag"`
+	Queued    int    `json:"queued"` // lines waiting to be sent
+}
+
+func (n *Network) status() NetworkStatus {
+	s := NetworkStatus{
+		Name:      n.Name,
+		Nick:      n.Nick(),
+		Connected: n.client() != nil,
+		Lag:       n.Lag().String(),
+		Queued:    n.queue.pending(),
+	}
+	n.mu.Lock()
+	s.Joined = n.joined
+	n.mu.Unlock()
+	if s.Joined {
+		s.Uptime = n.Uptime().Round(time.Second).String()
+	}
+	return s
+}
+
+// ChannelStatus is where the bot is on a network, and who it knows about there.
+type ChannelStatus struct {
+	Channels []string `json:"channels"`
+	Members  []string `json:"members"`
+}
+
+// ModuleStatus describes a registered module.
+type ModuleStatus struct {
+	Name     string `json:"name"`
+	Scope    string `json:"scope"`
+	Required bool   `json:"required"`
+	Fired    int    `json:"fired"`
+	Tripped  bool   `json:"tripped"` // switched off for panicking
+}
+
+// SeenStatus is the last thing someone was seen doing.
+type SeenStatus struct {
+	When     time.Time `json:"when"`
+	Activity Activity  `json:"activity"`
+	Channel  string    `json:"channel"`
+	Text     string    `json:"text"`
+	Other    string    `json:"other,omitempty"`
+}
+
+// status is a snapshot of everything the status server shows.
+type status struct {
+	Networks []NetworkStatus                  `json:"networks"`
+	Channels map[string]ChannelStatus         `json:"channels"`
+	Modules  []ModuleStatus                   `json:"modules"`
+	Scores   map[string]Score                 `json:"scores"`
+	Seen     map[string]map[string]SeenStatus `json:"seen"`
+	Combat   map[string]map[string]int        `json:"combat"`
+}
+
+// Endpoints are the JSON views of the status, as linked from the dashboard.
+func (s *status) Endpoints() []string {
+	return []string{"status", "channels", "modules", "scores", "seen", "combat", "export"}
+}
+
+// snapshot copies the bot's state for the status server. It runs on the dispatch loop.
+func (bot *IrcBot) snapshot() *status {
+	s := &status{
+		Channels: make(map[string]ChannelStatus),
+		Scores:   make(map[string]Score),
+		Seen:     make(map[string]map[string]SeenStatus),
+		Combat:   make(map[string]map[string]int),
+	}
+
+	for _, n := range bot.sortedNetworks() {
+		name := n.Name
+		s.Networks = append(s.Networks, n.status())
+
+		cs := ChannelStatus{Channels: n.Channels(), Members: []string{}}
+		everyone := make(map[string]bool)
+		for _, nicks := range n.members {
+			for nick := range nicks {
+				everyone[nick] = true
+			}
+		}
+		for nick := range everyone {
+			cs.Members = append(cs.Members, nick)
+		}
+		sort.Strings(cs.Members)
+		s.Channels[name] = cs
+
+		seen := make(map[string]SeenStatus)
+		for nick, info := range n.seen {
+			a, last := info.latest()
+			seen[nick] = SeenStatus{last.When, a, last.Channel, last.Text, last.Other}
+		}
+		s.Seen[name] = seen
+
+		health := make(map[string]int)
+		for nick, hp := range n.health {
+			health[nick] = hp
+		}
+		s.Combat[name] = health
+	}
+
+	for _, m := range bot.modules {
+		scope := "shared"
+		if m.Scope == PerNetwork {
+			scope = "per-network"
+		}
+		s.Modules = append(s.Modules, ModuleStatus{m.Name, scope, m.Required, int(bot.metrics.fired.Value(m.Name)), bot.tripped(m.Name)})
+	}
+
+	for nick, score := range scoreMap {
+		s.Scores[nick] = score
+	}
+	return s
+}
+
+var dashboard = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gobot</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+th { border-bottom: 1px solid #999; }
+</style>
+</head>
+<body>
+<h1>gobot</h1>
+
+<h2>Networks</h2>
+<table>
+<tr><th>Name</th><th>Nick</th><th>Connected</th><th>Joined</th><th>Uptime</th><th>Lag</th><th>Queued</th><th>Channels</th><th>Members</th></tr>
+{{range .Networks}}{{$c := index $.Channels .Name}}<tr><td>{{.Name}}</td><td>{{.Nick}}</td><td>{{.Connected}}</td><td>{{.Joined}}</td><td>{{.Uptime}}</td><td>{{.Lag}}</td><td>{{.Queued}}</td><td>{{range $c.Channels}}{{.}} {{end}}</td><td>{{range $c.Members}}{{.}} {{end}}</td></tr>
+{{end}}</table>
+
+<h2>Modules</h2>
+<table>
+<tr><th>Name</th><th>Scope</th><th>Required</th><th>Fired</th><th>Tripped</th></tr>
+{{range .Modules}}<tr><td>{{.Name}}</td><td>{{.Scope}}</td><td>{{.Required}}</td><td>{{.Fired}}</td><td>{{.Tripped}}</td></tr>
+{{end}}</table>
+
+<h2>Scores</h2>
+<table>
+<tr><th>Nick</th><th>Score</th></tr>
+{{range $nick, $score := .Scores}}<tr><td>{{$nick}}</td><td>{{$score.Total}}</td></tr>
+{{end}}</table>
+
+<h2>Seen</h2>
+<table>
+<tr><th>Network</th><th>Nick</th><th>When</th><th>Doing</th><th>Channel</th><th>Text</th></tr>
+{{range $network, $seen := .Seen}}{{range $nick, $info := $seen}}<tr><td>{{$network}}</td><td>{{$nick}}</td><td>{{$info.When.Format "2006-01-02 15:04:05"}}</td><td>{{$info.Activity}}</td><td>{{$info.Channel}}</td><td>{{$info.Text}}</td></tr>
+{{end}}{{end}}</table>
+
+<h2>Combat</h2>
+<table>
+<tr><th>Network</th><th>Nick</th><th>HP</th></tr>
+{{range $network, $health := .Combat}}{{range $nick, $hp := $health}}<tr><td>{{$network}}</td><td>{{$nick}}</td><td>{{$hp}}</td></tr>
+{{end}}{{end}}</table>
+
+<p>As JSON:{{range $i, $path := .Endpoints}}{{if $i}},{{end}} <a href="{{$path}}{{if $.Token}}?token={{$.Token}}{{end}}">{{$path}}</a>{{end}}.</p>
+</body>
+</html>
+`))
+
+// StatusHandler serves the bot's state: a dashboard at /, JSON at /status, /channels, /modules, /scores, /seen and
+// /combat, metrics for Prometheus at /metrics, and a History to download at /export. If token isn't empty, requests need it, either as a bearer token or a token parameter.
+func (bot *IrcBot) StatusHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	serve := func(path string, fn func(w http.ResponseWriter, r *http.Request, s *status)) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if path == "/" && r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			var s *status
+			if err := bot.do(func() { s = bot.snapshot() }); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			fn(w, r, s)
+		})
+	}
+	asJSON := func(path string, pick func(s *status) interface{}) {
+		serve(path, func(w http.ResponseWriter, _ *http.Request, s *status) {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(pick(s)); err != nil {
+				statusLog.Warn("Unable to write response", "path", path, "err", err)
+			}
+		})
+	}
+
+	serve("/", func(w http.ResponseWriter, r *http.Request, s *status) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// Links to the JSON pass the token along, if that's how we got it.
+		data := struct {
+			*status
+			Token string
+		}{s, r.URL.Query().Get("token")}
+		if err := dashboard.Execute(w, data); err != nil {
+			statusLog.Warn("Unable to render dashboard", "err", err)
+		}
+	})
+	asJSON("/status", func(s *status) interface{} { return s.Networks })
+	asJSON("/channels", func(s *status) interface{} { return s.Channels })
+	asJSON("/modules", func(s *status) interface{} { return s.Modules })
+	asJSON("/scores", func(s *status) interface{} { return s.Scores })
+	asJSON("/seen", func(s *status) interface{} { return s.Seen })
+	asJSON("/combat", func(s *status) interface{} { return s.Combat })
+	mux.HandleFunc("/metrics", bot.metricsHandler)
+	mux.HandleFunc("/export", bot.exportHandler)
+
+	if token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			got = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// exportHandler serves the bot's History: as JSON, or with format=csv, one table of it, karma or seen.
+func (bot *IrcBot) exportHandler(w http.ResponseWriter, r *http.Request) {
+	var h History
+	if err := bot.do(func() { h = bot.Export() }); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = h.WriteJSON(w)
+	case "csv":
+		table := r.URL.Query().Get("table")
+		if table == "" {
+			table = "karma"
+		}
+		if table != "karma" && table != "seen" {
+			http.Error(w, "table should be karma or seen", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v.csv", table))
+		err = h.WriteCSV(w, table)
+	default:
+		http.Error(w, "format should be json or csv", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		statusLog.Warn("Unable to write export", "err", err)
+	}
+}
+
+// serveStatus runs the status server on addr until ctx is done.
+func (bot *IrcBot) serveStatus(ctx context.Context, addr, token string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		statusLog.Error("Unable to start status server", "addr", addr, "err", err)
+		return
+	}
+	srv := &http.Server{Handler: bot.StatusHandler(token), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	statusLog.Info("Serving status", "addr", l.Addr())
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		statusLog.Error("Status server stopped", "err", err)
+	}
+}
+
+// checkLoopback returns an error unless addr is host:port on the loopback interface. The status server shows
+// everything anyone has said, so it isn't for the world to see.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%v isn't a loopback address", host)
+	}
+	return nil
+}
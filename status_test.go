@@ -0,0 +1,91 @@
+package youandmeandirc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusHandler(t *testing.T) {
+	bot, srv := startBot(t)
+	srv.Say("alice", "#test", "bob++")
+	srv.Expect(`^PRIVMSG #test :bob's score is now 1$`)
+
+	h := bot.StatusHandler("sekrit")
+	get := func(path, auth string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, auth := range []string{"", "wrong"} {
+		if w := get("/scores", auth); w.Code != http.StatusUnauthorized {
+			t.Errorf("GET /scores with token %q => %v; want %v", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	var scores map[string]Score
+	if err := json.NewDecoder(get("/scores", "sekrit").Body).Decode(&scores); err != nil {
+		t.Fatal(err)
+	}
+	if got := scores["bob"].Total; got != 1 {
+		t.Errorf("bob's score => %v; want 1", got)
+	}
+
+	var modules []ModuleStatus
+	if err := json.NewDecoder(get("/modules", "sekrit").Body).Decode(&modules); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range modules {
+		if m.Name == "score" && m.Fired != 1 {
+			t.Errorf("score fired %v times; want 1", m.Fired)
+		}
+	}
+
+	var networks []NetworkStatus
+	if err := json.NewDecoder(get("/status", "sekrit").Body).Decode(&networks); err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 1 || !networks[0].Connected || !networks[0].Joined || networks[0].Nick != "gobot" {
+		t.Errorf("status => %+v; want gobot connected and joined on test", networks)
+	}
+
+	if got := get("/export?format=csv", "sekrit").Body.String(); !strings.Contains(got, "\nbob,true,alice,") {
+		t.Errorf("GET /export?format=csv => %q; want alice's point for bob", got)
+	}
+
+	page := get("/?token=sekrit", "").Body.String()
+	for _, want := range []string{"<td>bob</td><td>1</td>", `href="scores?token=sekrit"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("dashboard doesn't contain %q:\n%v", want, page)
+		}
+	}
+}
+
+func TestCheckLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"127.0.0.1:6680", true},
+		{"[::1]:6680", true},
+		{"localhost:6680", true},
+		{"0.0.0.0:6680", false},
+		{":6680", false},
+		{"example.com:6680", false},
+		{"127.0.0.1", false},
+	}
+
+	for _, test := range tests {
+		if err := checkLoopback(test.addr); (err == nil) != test.ok {
+			t.Errorf("checkLoopback(%q) => %v; want ok %v", test.addr, err, test.ok)
+		}
+	}
+}
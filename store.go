@@ -0,0 +1,116 @@
+package youandmeandirc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var storeLog = logging.Subsystem("store")
+
+// flushInterval is how often module state is written out while the bot runs, so that a crash loses no more than that.
+const flushInterval = time.Minute
+
+// persisted is module state which is kept in the state directory between runs, as JSON.
+type persisted struct {
+	name string      // The file is name.json.
+	v    interface{} // A pointer to the state.
+}
+
+func (p persisted) path(dir string) string {
+	return filepath.Join(dir, p.name+".json")
+}
+
+// load reads the state in from dir. A missing file just means there's nothing saved yet.
+func (p persisted) load(dir string) error {
+	b, err := os.ReadFile(p.path(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, p.v); err != nil {
+		return fmt.Errorf("%v: %v", p.path(dir), err)
+	}
+	return nil
+}
+
+// save writes the state out to dir. It writes to a temporary file first so a crash can't leave a file half-written.
+func (p persisted) save(dir string) error {
+	b, err := json.MarshalIndent(p.v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%v: %v", p.name, err)
+	}
+	tmp := p.path(dir) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path(dir))
+}
+
+// persist arranges for v, a pointer to some module state, to be loaded from and flushed to the state directory as
+// name.json. Modules call it when their listener is built. Without a state directory, nothing is kept.
+func (bot *IrcBot) persist(name string, v interface{}) {
+	p := persisted{name, v}
+	bot.persisted = append(bot.persisted, p)
+	if bot.stateDir == "" {
+		return
+	}
+	if err := p.load(bot.stateDir); err != nil {
+		storeLog.Error("Unable to load state, starting afresh", "name", name, "err", err)
+	}
+}
+
+// SetStateDir sets where module state is kept between runs, and loads whatever is there. It should be called before
+// the bot starts.
+func (bot *IrcBot) SetStateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, p := range bot.persisted {
+		if err := p.load(dir); err != nil {
+			return err
+		}
+	}
+	bot.stateDir = dir
+	return nil
+}
+
+// Flush writes all module state to the state directory, if there is one.
+func (bot *IrcBot) Flush() error {
+	if bot.stateDir == "" {
+		return nil
+	}
+	var errs []error
+	for _, p := range bot.persisted {
+		if err := p.save(bot.stateDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runFlusher flushes module state on the dispatch loop every flushInterval, until ctx is done. The bot flushes once
+// more when it shuts down.
+func (bot *IrcBot) runFlusher(ctx context.Context) {
+	for {
+		select {
+		case <-bot.clock.After(flushInterval):
+			var err error
+			if bot.do(func() { err = bot.Flush() }) != nil {
+				return
+			}
+			if err != nil {
+				storeLog.Error("Unable to save state", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
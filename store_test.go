@@ -0,0 +1,99 @@
+package youandmeandirc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestPersistRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	type state struct {
+		Counts map[string]int
+	}
+
+	before := &IrcBot{}
+	if err := before.SetStateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	saved := state{Counts: map[string]int{"golang": 3}}
+	before.persist("counts", &saved)
+	if err := before.Flush(); err != nil {
+		t.Fatalf("Flush() => %v", err)
+	}
+
+	// State registered before the directory is set gets loaded when it is.
+	after := &IrcBot{}
+	var loaded state
+	after.persist("counts", &loaded)
+	if err := after.SetStateDir(dir); err != nil {
+		t.Fatalf("SetStateDir(%q) => %v", dir, err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("loaded %+v; want %+v", loaded, saved)
+	}
+
+	// Nothing saved yet isn't an error.
+	var missing state
+	after.persist("missing", &missing)
+	if missing.Counts != nil {
+		t.Errorf("loaded %+v from a file which doesn't exist", missing)
+	}
+}
+
+func TestFlushesWhileRunning(t *testing.T) {
+	dir := t.TempDir()
+	bot, err := NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := irctest.NewClock(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+	if err := bot.SetStateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	bot.persist("counts", &counts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- bot.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Nothing's written until flushInterval has passed, and then it's written without the bot stopping.
+	bot.do(func() { counts["golang"] = 3 })
+	path := filepath.Join(dir, "counts.json")
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%v before flushInterval => %v; want it not to exist", path, err)
+	}
+	for clock.Waiters() < 2 { // the scheduler and the flusher
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(flushInterval)
+	var saved map[string]int
+	for i := 0; ; i++ {
+		if b, err := os.ReadFile(path); err == nil && json.Unmarshal(b, &saved) == nil {
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("%v wasn't written after %v", path, flushInterval)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if want := map[string]int{"golang": 3}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved %v; want %v", saved, want)
+	}
+}
@@ -0,0 +1,171 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var tellLog = logging.Module("tell")
+
+// Limits on memos waiting to be delivered: how many one nick can leave, and how many one nick can have waiting.
+const (
+	maxMemosFrom = 10
+	maxMemosTo   = 20
+)
+
+// Memo is a message left for someone, to be passed on when they next show up.
+type Memo struct {
+	ID   int
+	From string
+	To   string
+	Text string
+	// Channel is where it was left, and where it's passed on. Memos left in private, or to be passed on privately,
+	// have none.
+	Channel string `json:",omitempty"`
+	When    time.Time
+}
+
+// memos are the memos waiting on a network.
+type memos struct {
+	NextID int
+	Memos  []Memo
+}
+
+var (
+	// tellRe matches e.g. "gobot, tell bob the build's fixed", and "gobot, privately tell bob the build's fixed".
+	tellRe = regexp.MustCompile(`^(\S+)[,:] (privately )?tell (\S+) (.+)$`)
+	// memosRe matches "gobot, memos" and "gobot, memos?".
+	memosRe = regexp.MustCompile(`^(\S+)[,:] memos\??$`)
+	// forgetMemoRe matches e.g. "gobot, forget memo 3".
+	forgetMemoRe = regexp.MustCompile(`^(\S+)[,:] forget memo #?(\d+)$`)
+)
+
+// tellListener takes memos for people who aren't around, and passes them on when they next say something or join a
+// channel. A memo is only passed on in the channel it was left in; anywhere else, and for memos left in private or
+// asked to be passed on privately, it's passed on in private.
+func (bot *IrcBot) tellListener(n *Network) (tell Listener) {
+	var waiting memos
+	bot.persist("memos-"+n.Name, &waiting)
+
+	count := func(keep func(m Memo) bool) int {
+		c := 0
+		for _, m := range waiting.Memos {
+			if keep(m) {
+				c++
+			}
+		}
+		return c
+	}
+
+	// deliver passes on everything waiting for nick, who just showed up in channel.
+	deliver := func(ctx context.Context, nick, channel string) bool {
+		var kept []Memo
+		delivered := false
+		for _, m := range waiting.Memos {
+			if !n.sameNick(m.To, nick) {
+				kept = append(kept, m)
+				continue
+			}
+			f := bot.timeFormatFor(n.Name, nick)
+			if m.Channel == "" || !n.sameNick(m.Channel, channel) {
+				n.Say(ctx, nick, fmt.Sprintf("%v left you a message %v: %v", m.From, f.ago(m.When), m.Text))
+			} else {
+				n.Say(ctx, channel, fmt.Sprintf("%v: %v left you a message %v: %v", nick, m.From, f.ago(m.When), m.Text))
+			}
+			tellLog.Debug("Delivered memo", "network", n.Name, "id", m.ID, "to", nick)
+			delivered = true
+		}
+		waiting.Memos = kept
+		return delivered
+	}
+
+	tell = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+		switch msg.Command {
+		case irc.Join:
+			return deliver(ctx, msg.Nick, msg.Channel), false
+		case irc.Privmsg:
+		default:
+			return
+		}
+		if isChannel(msg.Channel) {
+			fired = deliver(ctx, msg.Nick, msg.Channel)
+		}
+
+		// Answers go back where the question came from: the channel, or a private message.
+		replyTo, private := msg.Channel, !isChannel(msg.Channel)
+		if private {
+			replyTo = msg.Nick
+		}
+		reply := func(format string, a ...interface{}) (bool, bool) {
+			n.Say(ctx, replyTo, fmt.Sprintf("%v: %v", msg.Nick, fmt.Sprintf(format, a...)))
+			return true, true
+		}
+		from := func(m Memo) bool { return n.sameNick(m.From, msg.Nick) }
+
+		if match := memosRe.FindStringSubmatch(msg.Text); match != nil && n.sameNick(match[1], n.Nick()) {
+			var parts []string
+			f := bot.timeFormatFor(n.Name, msg.Nick)
+			for _, m := range waiting.Memos {
+				switch {
+				case !from(m):
+				case m.Channel == "" && !private:
+					// What's said in private stays that way.
+					parts = append(parts, fmt.Sprintf("#%d for %v, %v, in private", m.ID, m.To, f.ago(m.When)))
+				default:
+					parts = append(parts, fmt.Sprintf("#%d for %v, %v: %v", m.ID, m.To, f.ago(m.When), m.Text))
+				}
+			}
+			if len(parts) == 0 {
+				return reply("You don't have any memos waiting.")
+			}
+			return reply("%v", strings.Join(parts, "; "))
+		}
+
+		if match := forgetMemoRe.FindStringSubmatch(msg.Text); match != nil && n.sameNick(match[1], n.Nick()) {
+			id, _ := strconv.Atoi(match[2])
+			for i, m := range waiting.Memos {
+				if m.ID == id && from(m) {
+					waiting.Memos = append(waiting.Memos[:i], waiting.Memos[i+1:]...)
+					return reply("OK, I won't tell %v.", m.To)
+				}
+			}
+			return reply("You don't have a memo #%d waiting.", id)
+		}
+
+		match := tellRe.FindStringSubmatch(msg.Text)
+		if match == nil || !n.sameNick(match[1], n.Nick()) {
+			return
+		}
+		privately, to, text := match[2] != "", match[3], match[4]
+		switch {
+		case n.sameNick(to, n.Nick()):
+			return reply("I'm right here.")
+		case n.sameNick(to, msg.Nick):
+			return reply("You could just tell yourself.")
+		case count(from) >= maxMemosFrom:
+			return reply("You've already got %d memos waiting. Forget one first.", maxMemosFrom)
+		case count(func(m Memo) bool { return n.sameNick(m.To, to) }) >= maxMemosTo:
+			return reply("%v has too many memos waiting already.", to)
+		}
+
+		waiting.NextID++
+		m := Memo{ID: waiting.NextID, From: msg.Nick, To: to, Text: text, When: bot.clock.Now()}
+		if !private && !privately {
+			m.Channel = msg.Channel
+		}
+		waiting.Memos = append(waiting.Memos, m)
+		tellLog.Debug("Took memo", "network", n.Name, "id", m.ID, "from", m.From, "to", m.To, "channel", m.Channel)
+		if privately {
+			return reply("OK, I'll tell %v privately when I next see them. (That's memo #%d.)", to, m.ID)
+		}
+		return reply("OK, I'll tell %v when I next see them. (That's memo #%d.)", to, m.ID)
+	}
+	return
+}
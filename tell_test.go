@@ -0,0 +1,127 @@
+package youandmeandirc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestTell(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	bot.SetClock(clock)
+
+	for _, line := range []string{
+		":alice!alice@test PRIVMSG #test :gobot, tell [bob] the build's fixed",
+		":alice!alice@test PRIVMSG gobot :gobot, tell carol your secret's safe",
+		":alice!alice@test PRIVMSG #test :gobot, tell alice to stretch",
+		":alice!alice@test PRIVMSG #test :gobot, memos",
+		":dave!dave@test PRIVMSG #test :gobot, forget memo 1",
+		":{BOB}!bob@test PRIVMSG #test :morning",
+		":{BOB}!bob@test PRIVMSG #test :morning again",
+		":carol!carol@test JOIN #test",
+		":alice!alice@test PRIVMSG #test :gobot, memos",
+	} {
+		msg := *irc.NewMessage(line)
+		msg.Network = "test"
+		bot.runListeners(msg)
+		clock.Advance(time.Hour)
+	}
+	flush(n)
+
+	want := []string{
+		"alice: OK, I'll tell [bob] when I next see them. (That's memo #1.)",
+		"alice: You could just tell yourself.",
+		// Memos left in private stay that way.
+		"alice: #1 for [bob], 3 hours ago: the build's fixed; #2 for carol, 2 hours ago, in private",
+		"dave: You don't have a memo #1 waiting.",
+		"{BOB}: alice left you a message 5 hours ago: the build's fixed",
+		"alice: You don't have any memos waiting.",
+	}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said in #test:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	want = []string{"alice: OK, I'll tell carol when I next see them. (That's memo #2.)"}
+	if got := client.Said("alice"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said to alice %q; want %q", got, want)
+	}
+	want = []string{"alice left you a message 6 hours ago: your secret's safe"}
+	if got := client.Said("carol"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said to carol %q; want %q", got, want)
+	}
+}
+
+func TestTellDelivery(t *testing.T) {
+	bot, n, client := newTestBot(t)
+	bot.SetAdmins([]string{"bob"})
+
+	for _, line := range []string{
+		":alice!alice@test PRIVMSG #test :gobot, tell bob the build's fixed",
+		":alice!alice@test PRIVMSG #other :gobot, tell bob the other build's fixed",
+		":alice!alice@test PRIVMSG #test :gobot, privately tell bob you're hired",
+		// Whatever bob says first, even something another module answers, gets them their memos.
+		":bob!bob@test PRIVMSG #test :gobot, block mondays",
+	} {
+		msg := *irc.NewMessage(line)
+		msg.Network = "test"
+		bot.runListeners(msg)
+	}
+	flush(n)
+
+	want := []string{
+		"alice: OK, I'll tell bob when I next see them. (That's memo #1.)",
+		"alice: OK, I'll tell bob privately when I next see them. (That's memo #3.)",
+		"bob: alice left you a message just now: the build's fixed",
+		"OK, nobody can change mondays's score now.",
+	}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said in #test:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// What was left in #other isn't for #test.
+	want = []string{
+		"alice left you a message just now: the other build's fixed",
+		"alice left you a message just now: you're hired",
+	}
+	if got := client.Said("bob"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said to bob:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTellLimits(t *testing.T) {
+	bot, n, client := newTestBot(t)
+
+	for i := 0; i < maxMemosFrom; i++ {
+		bot.runListeners(privmsg("alice", fmt.Sprintf("gobot, tell bob %d", i)))
+	}
+	bot.runListeners(privmsg("alice", "gobot, tell bob one too many"))
+	for i := 0; i < maxMemosTo-maxMemosFrom; i++ {
+		bot.runListeners(privmsg("carol", fmt.Sprintf("gobot, tell bob %d", i)))
+	}
+	flush(n)
+	client.Reset()
+	bot.runListeners(privmsg("dave", "gobot, tell bob hello"))
+	bot.runListeners(privmsg("dave", "gobot, tell gobot hello"))
+	flush(n)
+
+	want := []string{
+		"dave: bob has too many memos waiting already.",
+		"dave: I'm right here.",
+	}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	flush(n)
+	client.Reset()
+	bot.runListeners(privmsg("alice", "gobot, tell carol hello"))
+	flush(n)
+	want = []string{fmt.Sprintf("alice: You've already got %d memos waiting. Forget one first.", maxMemosFrom)}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package youandmeandirc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxThingLength is the longest thing that can have a score, so that nobody gets points for a whole sentence.
+const maxThingLength = 50
+
+// KarmaAdmin is what admins have decided about scores: things nobody can change the score of, and other names for
+// things which have a score. Names are kept lower case.
+type KarmaAdmin struct {
+	Blocked map[string]bool   `json:"blocked"`
+	Aliases map[string]string `json:"aliases"` // alias to the name it's scored under
+}
+
+var karmaAdmin = newKarmaAdmin()
+
+func newKarmaAdmin() KarmaAdmin {
+	return KarmaAdmin{Blocked: make(map[string]bool), Aliases: make(map[string]string)}
+}
+
+// scoreKey is what target is scored under: where its alias points, if it has one, and then however it was first
+// written, if it already has a score.
+func scoreKey(target string) string {
+	if to, ok := karmaAdmin.Aliases[strings.ToLower(target)]; ok {
+		target = to
+	}
+	name, _, _ := lookupScore(target)
+	return name
+}
+
+// blockScore stops, or with block false, lets, anyone change the score of target. If target is an alias, it's the
+// score it counts toward that's blocked, since that's what changes when someone gives the alias a point.
+func blockScore(target string, block bool) string {
+	name := scoreKey(target)
+	key := strings.ToLower(name)
+	if block == karmaAdmin.Blocked[key] {
+		if block {
+			return fmt.Sprintf("%v is already blocked.", name)
+		}
+		return fmt.Sprintf("%v isn't blocked.", name)
+	}
+	if block {
+		karmaAdmin.Blocked[key] = true
+		return fmt.Sprintf("OK, nobody can change %v's score now.", name)
+	}
+	delete(karmaAdmin.Blocked, key)
+	return fmt.Sprintf("OK, %v's score can change again.", name)
+}
+
+// renameScore moves from's score to a new name, along with its aliases, and its block if it's blocked.
+func renameScore(from, to string) string {
+	from, score, ok := lookupScore(from)
+	if !ok {
+		return fmt.Sprintf("%v doesn't have a score.", from)
+	}
+	if existing, _, ok := lookupScore(to); ok && existing != from {
+		return fmt.Sprintf("%v already has a score. Merge them instead?", existing)
+	}
+	delete(scoreMap, from)
+	scoreMap[to] = score
+	repoint(from, to)
+	if karmaAdmin.Blocked[strings.ToLower(from)] {
+		delete(karmaAdmin.Blocked, strings.ToLower(from))
+		karmaAdmin.Blocked[strings.ToLower(to)] = true
+	}
+	return fmt.Sprintf("OK, %v is now %v.", from, to)
+}
+
+// mergeScores adds alias's score to name's, and has points for alias go to name from now on.
+func mergeScores(alias, name string) string {
+	alias, from, hasFrom := lookupScore(alias)
+	name, into, _ := lookupScore(name)
+	if strings.EqualFold(alias, name) {
+		return "That's the same thing."
+	}
+	if hasFrom {
+		into.Total += from.Total
+		into.Person = into.Person || from.Person
+		into.Points = append(into.Points, from.Points...)
+		sort.SliceStable(into.Points, func(i, j int) bool { return into.Points[i].When.Before(into.Points[j].When) })
+		delete(scoreMap, alias)
+		scoreMap[name] = into
+	}
+	repoint(alias, name)
+	karmaAdmin.Aliases[strings.ToLower(alias)] = name
+	return fmt.Sprintf("OK, %v counts as %v, who has %d now.", alias, name, into.Total)
+}
+
+// splitTargets splits s into words, except for words in parentheses, which stick together as in
+// "(the build) build".
+func splitTargets(s string) []string {
+	var targets []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if strings.HasPrefix(s, "(") {
+			if end := strings.Index(s, ")"); end > 0 {
+				targets = append(targets, strings.Join(strings.Fields(s[1:end]), " "))
+				s = s[end+1:]
+				continue
+			}
+		}
+		word, rest, _ := strings.Cut(s, " ")
+		targets = append(targets, word)
+		s = rest
+	}
+	return targets
+}
+
+// repoint has aliases for from point to to instead.
+func repoint(from, to string) {
+	for alias, name := range karmaAdmin.Aliases {
+		if strings.EqualFold(name, from) {
+			karmaAdmin.Aliases[alias] = to
+		}
+	}
+	delete(karmaAdmin.Aliases, strings.ToLower(to))
+}
@@ -0,0 +1,202 @@
+package youandmeandirc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irc"
+	"github.com/wonderzombie/youandmeandirc/logging"
+)
+
+var timezoneLog = logging.Module("timezone")
+
+// SetLocation sets the timezone times are shown in for people who haven't picked their own, and which schedules and
+// "today" or "this month" go by.
+func (bot *IrcBot) SetLocation(loc *time.Location) {
+	bot.location = loc
+}
+
+// localNow is the time now in the bot's timezone.
+func (bot *IrcBot) localNow() time.Time {
+	return bot.clock.Now().In(bot.location)
+}
+
+// timeFormat shows times to one person: how long ago they were, or when they were in that person's timezone.
+type timeFormat struct {
+	now time.Time
+	loc *time.Location
+}
+
+// timeFormatFor returns how to show times to nick on network: in the timezone they picked, or else the bot's.
+func (bot *IrcBot) timeFormatFor(network, nick string) timeFormat {
+	loc := bot.location
+	if l, ok := bot.timezones[timezoneKey(network, nick)]; ok {
+		loc = l
+	}
+	return timeFormat{bot.clock.Now().In(loc), loc}
+}
+
+// ago says how long before now t was, or how long after, the way people would: "just now", "an hour ago", "yesterday",
+// "in 3 days". Whole days go by the calendar, so something at 23:00 on Monday is "yesterday" all Tuesday long.
+func (f timeFormat) ago(t time.Time) string {
+	d := f.now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var s string
+	switch {
+	case d < time.Minute:
+		if future {
+			return "in a moment"
+		}
+		return "just now"
+	case d < time.Hour:
+		s = count(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		s = count(int(d/time.Hour), "hour")
+	default:
+		days := calendarDays(t.In(f.loc), f.now)
+		if future {
+			days = calendarDays(f.now, t.In(f.loc))
+		}
+		switch {
+		case days == 1 && future:
+			return "tomorrow"
+		case days == 1:
+			return "yesterday"
+		case days < 14:
+			s = count(days, "day")
+		case days < 60:
+			s = count(days/7, "week")
+		case days < 365:
+			s = count(days/30, "month")
+		default:
+			s = count(days/365, "year")
+		}
+	}
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// at says when t was in f's timezone, as in "Oct 18 14:05 BST", with the year if it isn't this year.
+func (f timeFormat) at(t time.Time) string {
+	t = t.In(f.loc)
+	if t.Year() != f.now.Year() {
+		return t.Format("Jan 2 2006 15:04 MST")
+	}
+	return t.Format("Jan 2 15:04 MST")
+}
+
+// day says which day t was in f's timezone, as in "Oct 18", with the year if it isn't this year.
+func (f timeFormat) day(t time.Time) string {
+	t = t.In(f.loc)
+	if t.Year() != f.now.Year() {
+		return t.Format("Jan 2 2006")
+	}
+	return t.Format("Jan 2")
+}
+
+// calendarDays is how many midnights there are between from and to, which are in the same timezone.
+func calendarDays(from, to time.Time) int {
+	y, m, d := from.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	y, m, d = to.Date()
+	end := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return int(end.Sub(start) / (24 * time.Hour))
+}
+
+// count is n of unit, as in "an hour" or "3 hours".
+func count(n int, unit string) string {
+	if n != 1 {
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	if unit == "hour" {
+		return "an hour"
+	}
+	return "a " + unit
+}
+
+// timezones are the timezones people have picked, by timezoneKey. They're kept as names, but loaded as they're read
+// back, so that showing someone a time doesn't mean reading tzdata from disk.
+type timezones map[string]*time.Location
+
+func (z timezones) MarshalJSON() ([]byte, error) {
+	names := make(map[string]string, len(z))
+	for key, loc := range z {
+		names[key] = loc.String()
+	}
+	return json.Marshal(names)
+}
+
+// UnmarshalJSON reads timezones back by name. Any this system doesn't know any more are forgotten.
+func (z *timezones) UnmarshalJSON(b []byte) error {
+	var names map[string]string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+	*z = make(timezones, len(names))
+	for key, name := range names {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			timezoneLog.Warn("Forgetting unknown timezone", "key", key, "timezone", name, "err", err)
+			continue
+		}
+		(*z)[key] = loc
+	}
+	return nil
+}
+
+// timezoneKey is how a nick's timezone is kept: per network, ignoring case.
+func timezoneKey(network, nick string) string {
+	return network + " " + strings.ToLower(nick)
+}
+
+// timezoneRe matches "gobot, timezone", "gobot, timezone Europe/London" and "gobot, timezone reset".
+var timezoneRe = regexp.MustCompile(`^(\S+)[,:] timezone(?: (\S+))?$`)
+
+// timezoneListener lets people pick the timezone the bot shows them times in.
+func (bot *IrcBot) timezoneListener() (timezone Listener) {
+	bot.persist("timezones", &bot.timezones)
+
+	timezone = func(ctx context.Context, msg irc.Message) (fired, trap bool) {
+		if msg.Command != irc.Privmsg {
+			return
+		}
+		match := timezoneRe.FindStringSubmatch(msg.Text)
+		if match == nil || !strings.EqualFold(match[1], bot.Network(msg.Network).Nick()) {
+			return
+		}
+
+		key := timezoneKey(msg.Network, msg.Nick)
+		var out string
+		switch match[2] {
+		case "":
+			f := bot.timeFormatFor(msg.Network, msg.Nick)
+			out = fmt.Sprintf("%v, I show you times in %v, where it's %v.", msg.Nick, f.loc, f.now.Format("15:04 MST"))
+		case "reset":
+			delete(bot.timezones, key)
+			out = fmt.Sprintf("OK %v, back to %v.", msg.Nick, bot.location)
+		default:
+			loc, err := time.LoadLocation(match[2])
+			if err != nil || match[2] == "Local" {
+				out = fmt.Sprintf("%v, I don't know %v. Try something like Europe/London or America/New_York.", msg.Nick,
+					match[2])
+				break
+			}
+			bot.timezones[key] = loc
+			timezoneLog.Debug("Setting timezone", "network", msg.Network, "nick", msg.Nick, "timezone", loc)
+			out = fmt.Sprintf("OK %v, it's %v for you now.", msg.Nick, bot.clock.Now().In(loc).Format("15:04 MST"))
+		}
+		bot.Reply(ctx, msg, out)
+		return true, true
+	}
+	return
+}
@@ -0,0 +1,133 @@
+package youandmeandirc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wonderzombie/youandmeandirc/irctest"
+)
+
+func TestTimeFormatAgo(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	// 08:30 on a Tuesday, in London and in UTC.
+	now := time.Date(2026, 10, 20, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		then time.Time
+		loc  *time.Location
+		want string
+	}{
+		{now.Add(-20 * time.Second), time.UTC, "just now"},
+		{now.Add(-time.Minute), time.UTC, "a minute ago"},
+		{now.Add(-59 * time.Minute), time.UTC, "59 minutes ago"},
+		{now.Add(-time.Hour), time.UTC, "an hour ago"},
+		{now.Add(-23 * time.Hour), time.UTC, "23 hours ago"},
+		{now.Add(-30 * time.Hour), time.UTC, "yesterday"},
+		{now.Add(-40 * time.Hour), time.UTC, "2 days ago"},
+		// 23:30 on Saturday in UTC is already Sunday in London.
+		{time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC), time.UTC, "3 days ago"},
+		{time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC), london, "2 days ago"},
+		{now.AddDate(0, 0, -20), time.UTC, "2 weeks ago"},
+		{now.AddDate(0, -3, 0), time.UTC, "3 months ago"},
+		{now.AddDate(-2, 0, 0), time.UTC, "2 years ago"},
+		{now.Add(30 * time.Second), time.UTC, "in a moment"},
+		{now.Add(90 * time.Minute), time.UTC, "in an hour"},
+		{now.Add(30 * time.Hour), time.UTC, "tomorrow"},
+		{now.AddDate(0, 0, 3), time.UTC, "in 3 days"},
+	}
+
+	for _, test := range tests {
+		f := timeFormat{now.In(test.loc), test.loc}
+		if got := f.ago(test.then); got != test.want {
+			t.Errorf("%v before %v in %v => %q; want %q", test.then, now, test.loc, got, test.want)
+		}
+	}
+}
+
+func TestTimeFormatAt(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	now := time.Date(2026, 10, 20, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		then time.Time
+		loc  *time.Location
+		at   string
+		day  string
+	}{
+		{now.Add(-time.Hour), time.UTC, "Oct 20 07:30 UTC", "Oct 20"},
+		{now.Add(-time.Hour), london, "Oct 20 08:30 BST", "Oct 20"},
+		{time.Date(2025, 12, 31, 23, 30, 0, 0, time.UTC), time.UTC, "Dec 31 2025 23:30 UTC", "Dec 31 2025"},
+	}
+
+	for _, test := range tests {
+		f := timeFormat{now.In(test.loc), test.loc}
+		if got := f.at(test.then); got != test.at {
+			t.Errorf("at(%v) in %v => %q; want %q", test.then, test.loc, got, test.at)
+		}
+		if got := f.day(test.then); got != test.day {
+			t.Errorf("day(%v) in %v => %q; want %q", test.then, test.loc, got, test.day)
+		}
+	}
+}
+
+func TestTimezoneCommand(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	bot, n, client := newTestBot(t)
+	clock := irctest.NewClock(time.Date(2026, 10, 20, 8, 30, 0, 0, time.UTC))
+	bot.SetClock(clock)
+
+	bot.runListeners(privmsg("alice", "gobot, timezone"))
+	bot.runListeners(privmsg("alice", "gobot, timezone Mars/Olympus_Mons"))
+	bot.runListeners(privmsg("alice", "gobot, timezone America/New_York"))
+	bot.runListeners(privmsg("ALICE", "gobot, timezone"))
+	if got, want := bot.timeFormatFor("test", "alice").at(clock.Now()), "Oct 20 04:30 EDT"; got != want {
+		t.Errorf("the time for alice => %q; want %q", got, want)
+	}
+	if got, want := bot.timeFormatFor("test", "bob").at(clock.Now()), "Oct 20 08:30 UTC"; got != want {
+		t.Errorf("the time for bob => %q; want %q", got, want)
+	}
+	bot.runListeners(privmsg("alice", "gobot, timezone reset"))
+	flush(n)
+
+	want := []string{
+		"alice, I show you times in UTC, where it's 08:30 UTC.",
+		"alice, I don't know Mars/Olympus_Mons. Try something like Europe/London or America/New_York.",
+		"OK alice, it's 04:30 EDT for you now.",
+		"ALICE, I show you times in America/New_York, where it's 04:30 EDT.",
+		"OK alice, back to UTC.",
+	}
+	if got := client.Said("#test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("said:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTimezonesPersist(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	b, err := json.Marshal(timezones{timezoneKey("test", "alice"): ny})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"test alice":"America/New_York"}`; got != want {
+		t.Errorf("saved %v; want %v", got, want)
+	}
+
+	var z timezones
+	if err := json.Unmarshal([]byte(`{"test alice":"America/New_York","test bob":"Mars/Olympus_Mons"}`), &z); err != nil {
+		t.Fatal(err)
+	}
+	if len(z) != 1 || z[timezoneKey("test", "alice")].String() != "America/New_York" {
+		t.Errorf("loaded %v; want only alice's America/New_York", z)
+	}
+}
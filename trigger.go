@@ -0,0 +1,132 @@
+package youandmeandirc
+
+import (
+	"github.com/wonderzombie/youandmeandirc/irc"
+)
+
+// ResultCode is what a Trigger made of a message.
+type ResultCode int
+
+const (
+	Pass ResultCode = 1 + iota
+	Fired
+	Trap
+)
+
+// TODO: replace Listener with BotListener. This will allow just to just enumerate Listeners
+// instead of the rigmarole right now, where methods on IrcBot return Listeners.
+type BotListener func(*IrcBot, irc.Message) (bool, bool)
+
+type TriggerId string
+
+// API is like this, roughly:
+// Your module implements some function that returns some item that satisfies this interface.
+// Id() is used to identify your module to other modules. Therefore anything you export
+// on your struct is the API for other modules to interact with yours.
+//
+// Triggers are looked up by Id with IrcBot.Trigger. Messages say which network they're from, so Fire works out which
+// network's module to pass msg to from msg.Network. Like listeners, Fire has to be called from the dispatch loop.
+type Trigger interface {
+	Id() TriggerId
+	Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode
+}
+
+// RegisterTrigger makes t available to other modules through Trigger.
+func (bot *IrcBot) RegisterTrigger(t Trigger) {
+	bot.triggers[t.Id()] = t
+}
+
+func (bot *IrcBot) RegisterTriggers(ts ...Trigger) {
+	for _, t := range ts {
+		bot.RegisterTrigger(t)
+	}
+}
+
+// registerDefaults registers a Trigger for each of the built in modules that has one.
+func (bot *IrcBot) registerDefaults() {
+	bot.RegisterTriggers(
+		// This one should come first, if it's to abort all the rest.
+		SleepTrigger{},
+		JoinPartTrigger{},
+		RegexTrigger{},
+		CombatTrigger{},
+		ScoreTrigger{},
+		SeenTrigger{},
+	)
+}
+
+// Trigger returns the Trigger registered as id, or nil if there isn't one.
+func (bot *IrcBot) Trigger(id TriggerId) Trigger {
+	t, ok := bot.triggers[id]
+	if !ok {
+		return nil
+	}
+	return t
+}
+
+// fireModule passes msg to the named module's listener on msg's network, as a Trigger would, and says what it made of
+// it. Disabled and tripped modules Pass, as they do for runListeners.
+func (bot *IrcBot) fireModule(name string, msg irc.Message) ResultCode {
+	n := bot.Network(msg.Network)
+	if n == nil || bot.tripped(name) {
+		return Pass
+	}
+	for _, l := range n.listeners {
+		if l.Name != name {
+			continue
+		}
+		if !l.Required && msg.Channel != "" && !bot.settings.Enabled(msg.Network, msg.Channel, l.Name) {
+			return Pass
+		}
+		ctx, cancel := bot.handlerContext()
+		defer cancel()
+		switch fired, trap := bot.run(ctx, l, msg); {
+		case trap:
+			return Trap
+		case fired:
+			return Fired
+		}
+		return Pass
+	}
+	return Pass
+}
+
+// JoinPartTrigger fires the members module, which notices people coming and going.
+type JoinPartTrigger struct {
+	// NamesSet isn't used: who's around is kept for each network. See Network.Members.
+	NamesSet map[string]bool
+}
+
+func (t JoinPartTrigger) Id() TriggerId {
+	return TriggerId("namelist")
+}
+
+func (t JoinPartTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) ResultCode {
+	return bot.fireModule("members", msg)
+}
+
+// MentionMeTrigger fires the replies module, which answers people who mention the bot.
+type MentionMeTrigger struct{}
+
+func (t *MentionMeTrigger) Id() TriggerId {
+	return TriggerId("mentionme")
+}
+
+func (t *MentionMeTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) bool {
+	return bot.fireModule("replies", msg) != Pass
+}
+
+// PingTrigger reports whether msg is anything other than a PING. Connections answer PINGs themselves now, so there's
+// nothing left for it to do.
+type PingTrigger struct{}
+
+func (p *PingTrigger) Id() TriggerId {
+	return TriggerId("ping")
+}
+
+func (p *PingTrigger) Fire(msg irc.Message, bot *IrcBot, ids []TriggerId) bool {
+	if len(ids) > 0 {
+		botLog.Warn("Other triggers called before ping", "ids", ids)
+	}
+	return msg.Command != irc.Ping
+}
@@ -11,7 +11,21 @@ func has(haystack []string, needle string) bool {
 	return false
 }
 
+// hasFold is like has, but ignores case.
+func hasFold(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if strings.EqualFold(s, needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// last returns the last of ss, or "" if there aren't any.
 func last(ss []string) string {
+	if len(ss) == 0 {
+		return ""
+	}
 	return ss[len(ss)-1]
 }
 
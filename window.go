@@ -0,0 +1,198 @@
+package youandmeandirc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// window is a view of scores: all time, only points from a stretch of time, or with older points counting for less.
+type window struct {
+	// Name says which window it is, for titles, e.g. "last 7 days". It's empty for all time.
+	Name string
+	// From and To bound which points count. Zero means no bound.
+	From, To time.Time
+	// HalfLife, if it's set, is how long it takes a point to be worth half as much, as of Now.
+	HalfLife time.Duration
+	Now      time.Time
+}
+
+// allTime is every point, at full value.
+var allTime = window{}
+
+// score is what s is worth in the window.
+func (w window) score(s Score) float64 {
+	if w.From.IsZero() && w.To.IsZero() && w.HalfLife == 0 {
+		return float64(s.Total)
+	}
+	var total float64
+	for _, p := range s.Points {
+		if !w.From.IsZero() && p.When.Before(w.From) || !w.To.IsZero() && !p.When.Before(w.To) {
+			continue
+		}
+		v := -1.0
+		if p.Increase {
+			v = 1
+		}
+		if w.HalfLife > 0 {
+			v *= math.Pow(0.5, float64(w.Now.Sub(p.When))/float64(w.HalfLife))
+		}
+		total += v
+	}
+	return total
+}
+
+// counts reports whether s had any points in the window, and so belongs on its leaderboard.
+func (w window) counts(s Score) bool {
+	if w.From.IsZero() && w.To.IsZero() {
+		return true
+	}
+	for _, p := range s.Points {
+		if (w.From.IsZero() || !p.When.Before(w.From)) && (w.To.IsZero() || p.When.Before(w.To)) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatScore shows a whole score as it is, and a decayed one to a decimal place.
+func formatScore(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+var (
+	daysRe  = regexp.MustCompile(`^(\d+)d(ays?)?$`)
+	monthRe = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+)
+
+// parseWindow reads a word of a leaderboard query as a window: today, week, month, year, a number of days such as
+// 30d, a calendar month such as 2026-09, or decayed. Filler words like "this" are ignored. ok is false if the word
+// isn't about windows at all.
+func parseWindow(word string, now time.Time, halfLife time.Duration, w *window) (ok bool) {
+	days := func(n int) {
+		*w = window{Name: fmt.Sprintf("last %d days", n), From: now.AddDate(0, 0, -n), Now: now}
+	}
+	switch word {
+	case "this", "last", "past", "the":
+		return true
+	case "today":
+		y, m, d := now.Date()
+		*w = window{Name: "today", From: time.Date(y, m, d, 0, 0, 0, 0, now.Location()), Now: now}
+		return true
+	case "week":
+		days(7)
+		return true
+	case "month":
+		days(30)
+		return true
+	case "year":
+		days(365)
+		return true
+	case "decayed", "hot":
+		if halfLife <= 0 {
+			*w = allTime
+			return true
+		}
+		*w = window{Name: fmt.Sprintf("with a half-life of %v", shortDuration(halfLife)), HalfLife: halfLife, Now: now}
+		return true
+	}
+	if m := daysRe.FindStringSubmatch(word); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 {
+			return false
+		}
+		days(n)
+		return true
+	}
+	if m := monthRe.FindStringSubmatch(word); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if month < 1 || month > 12 {
+			return false
+		}
+		*w = monthWindow(year, time.Month(month), now.Location())
+		w.Now = now
+		return true
+	}
+	return false
+}
+
+// monthWindow is a calendar month's points, as a snapshot of how that month went.
+func monthWindow(year int, month time.Month, loc *time.Location) window {
+	from := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	return window{Name: from.Format("January 2006"), From: from, To: from.AddDate(0, 1, 0)}
+}
+
+// lastMonth is the calendar month before now's.
+func lastMonth(now time.Time) window {
+	last := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, 0, -1)
+	return monthWindow(last.Year(), last.Month(), now.Location())
+}
+
+// shortDuration formats d without the trailing zero units, e.g. 720h rather than 720h0m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// recapSchedule is when monthly recaps are posted: nine in the morning on the first of the month.
+const recapSchedule = "0 9 1 * *"
+
+// recapJob posts last month's karma to the job's channel.
+func (bot *IrcBot) recapJob(ctx context.Context, job Job) {
+	n := bot.Network(job.Network)
+	for _, line := range recapLines(lastMonth(bot.localNow())) {
+		n.Say(ctx, job.Target, line)
+	}
+}
+
+// recapLines sums up a month: who did best and worst, and who handed out the most points.
+func recapLines(w window) []string {
+	board := leaderboard(everything, w)
+	if len(board) == 0 {
+		return []string{fmt.Sprintf("Nobody's score changed in %v.", w.Name)}
+	}
+
+	size := 3
+	if size > len(board) {
+		size = len(board)
+	}
+	var items []string
+	for _, r := range board[:size] {
+		items = append(items, fmt.Sprintf("%v (%+d)", r.Nick, int(r.Total)))
+	}
+	line := fmt.Sprintf("Karma for %v: top %v.", w.Name, strings.Join(items, ", "))
+	if bottom := board[len(board)-1]; len(board) > size && bottom.Total < 0 {
+		line += fmt.Sprintf(" Bottom: %v (%+d).", bottom.Nick, int(bottom.Total))
+	}
+
+	given := make(map[string]int)
+	for _, score := range scoreMap {
+		for _, p := range score.Points {
+			if !p.When.Before(w.From) && p.When.Before(w.To) {
+				given[p.Granter]++
+			}
+		}
+	}
+	busiest, most := "", 0
+	for granter, n := range given {
+		if n > most || n == most && strings.ToLower(granter) < strings.ToLower(busiest) {
+			busiest, most = granter, n
+		}
+	}
+	line += fmt.Sprintf(" Busiest: %v, with %d.", busiest, most)
+	return []string{line}
+}